@@ -2,14 +2,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Supported values of PortCheck.Type.
+const (
+	checkTypeTCP  = "tcp"
+	checkTypeHTTP = "http"
+	checkTypeTLS  = "tls"
+	checkTypeDNS  = "dns"
+)
+
+// Supported values of PortCheck.Severity.
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+)
+
+// defaultMaxConcurrency limits how many checks run at once when
+// server.max_concurrency is not configured.
+const defaultMaxConcurrency = 10
+
+// defaultRetryBackoff is the wait before the second attempt of a check with
+// attempts > 1 when retry_backoff is not configured. It doubles after every
+// failed attempt.
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// errDeadlineExceeded is reported for checks that were still running (or had
+// not started yet) when the overall health check deadline passed.
+var errDeadlineExceeded = errors.New("deadline exceeded")
+
 func checkPort(host string, port int, timeout time.Duration) error {
+	return checkPortContext(context.Background(), host, port, timeout)
+}
+
+// checkPortContext dials host:port over TCP, giving up after timeout or when
+// ctx is done, whichever comes first.
+func checkPortContext(ctx context.Context, host string, port int, timeout time.Duration) error {
 	address := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.DialTimeout("tcp", address, timeout)
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
@@ -19,36 +58,280 @@ func checkPort(host string, port int, timeout time.Duration) error {
 	return nil
 }
 
-func performHealthCheck(cfg *Config) HealthStatus {
-	results := make([]PortCheckResult, 0, len(cfg.Checks))
-	allHealthy := true
-	failedPorts := []string{}
-
-	for _, portCheck := range cfg.Checks {
-		result := PortCheckResult{
-			Name:        portCheck.Name,
-			Host:        portCheck.Host,
-			Port:        portCheck.Port,
-			Description: portCheck.Description,
+// newResult returns a result carrying the configured fields of portCheck.
+func newResult(portCheck PortCheck) PortCheckResult {
+	return PortCheckResult{
+		Name:        portCheck.Name,
+		Host:        portCheck.Host,
+		Port:        portCheck.Port,
+		Description: portCheck.Description,
+		Source:      portCheck.Source,
+		Severity:    checkSeverity(portCheck),
+		Groups:      portCheck.Groups,
+		Tags:        portCheck.Tags,
+	}
+}
+
+// checkSeverity returns the severity of portCheck, defaulting to critical.
+func checkSeverity(portCheck PortCheck) string {
+	if portCheck.Severity == "" {
+		return severityCritical
+	}
+	return portCheck.Severity
+}
+
+// runCheck executes a single port check and converts the outcome into a result.
+func runCheck(ctx context.Context, cfg *Config, portCheck PortCheck) PortCheckResult {
+	result := newResult(portCheck)
+	result.CheckedAt = time.Now().Format(time.RFC3339)
+
+	// Use per-check timeout if specified, otherwise use server timeout
+	timeout := cfg.Server.Timeout
+	if portCheck.Timeout > 0 {
+		timeout = portCheck.Timeout
+	}
+
+	attempts := max(portCheck.Attempts, 1)
+	backoff := portCheck.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	// Every attempt starts from the configured fields, so details of a failed
+	// attempt do not leak into the final result.
+	base := result
+	var attemptErrors []string
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		result = base
+		start := time.Now()
+		err = executeCheck(ctx, portCheck, timeout, &result)
+		result.LatencyMS = durationMS(time.Since(start))
+		if err == nil {
+			err = checkLatency(portCheck, &result)
 		}
+		if err == nil {
+			break
+		}
+		attemptErrors = append(attemptErrors, err.Error())
+		if attempt >= attempts || !sleepContext(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+	}
+
+	if portCheck.Attempts > 1 {
+		result.Attempts = attempt
+		result.AttemptErrors = attemptErrors
+	}
+
+	if err != nil && ctx.Err() != nil {
+		err = errDeadlineExceeded
+	}
+	if err != nil {
+		result.Status = "unhealthy"
+		result.Error = err.Error()
+	} else if result.Status == "" {
+		result.Status = "healthy"
+	}
+
+	return result
+}
+
+// executeCheck performs one attempt of portCheck according to its type.
+func executeCheck(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	switch portCheck.Type {
+	case "", checkTypeTCP:
+		switch portCheck.Protocol {
+		case "", protocolTCP:
+			if portCheck.Send != "" || portCheck.Expect != "" {
+				return checkBanner(ctx, portCheck, timeout, result)
+			}
+			start := time.Now()
+			err := checkPortContext(ctx, portCheck.Host, portCheck.Port, timeout)
+			if err == nil {
+				result.ConnectMS = durationMS(time.Since(start))
+			}
+			return err
+		case protocolUDP:
+			return checkUDP(ctx, portCheck, timeout, result)
+		default:
+			return fmt.Errorf("unknown protocol %q", portCheck.Protocol)
+		}
+	case checkTypeHTTP:
+		return checkHTTP(ctx, portCheck, timeout, result)
+	case checkTypeTLS:
+		return checkTLS(ctx, portCheck, timeout, result)
+	case checkTypeDNS:
+		return checkDNS(ctx, portCheck, timeout, result)
+	default:
+		return fmt.Errorf("unknown check type %q", portCheck.Type)
+	}
+}
+
+// dialTimed connects like dialer.DialContext and records the connect latency
+// (TCP only) in result. Reads through the returned connection record the time
+// to the first received byte, both measured from the start of the dial.
+func dialTimed(ctx context.Context, dialer *net.Dialer, network, address string, result *PortCheckResult) (net.Conn, error) {
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if network != protocolUDP {
+		result.ConnectMS = durationMS(time.Since(start))
+	}
+	return &timedConn{Conn: conn, start: start, result: result}, nil
+}
+
+// timedConn records the time to first byte of a check on its first read.
+type timedConn struct {
+	net.Conn
+	start  time.Time
+	result *PortCheckResult
+}
+
+func (c *timedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.result.TTFBMS == 0 {
+		c.result.TTFBMS = durationMS(time.Since(c.start))
+	}
+	return n, err
+}
 
-		// Use per-check timeout if specified, otherwise use server timeout
-		timeout := cfg.Server.Timeout
-		if portCheck.Timeout > 0 {
-			timeout = portCheck.Timeout
+// checkLatency applies the latency thresholds of portCheck to a successful
+// result: above max_latency it fails, above warn_latency it is degraded.
+func checkLatency(portCheck PortCheck, result *PortCheckResult) error {
+	latency := time.Duration(result.LatencyMS * float64(time.Millisecond))
+	if portCheck.MaxLatency > 0 && latency > portCheck.MaxLatency {
+		return fmt.Errorf("latency %s exceeds max_latency %s", latency.Round(time.Millisecond), portCheck.MaxLatency)
+	}
+	if portCheck.WarnLatency > 0 && latency > portCheck.WarnLatency {
+		warning := fmt.Sprintf("latency %s exceeds warn_latency %s", latency.Round(time.Millisecond), portCheck.WarnLatency)
+		if result.Warning != "" {
+			warning = result.Warning + "; " + warning
 		}
+		result.Status = "degraded"
+		result.Warning = warning
+	}
+	return nil
+}
+
+// sleepContext waits for d and reports whether it elapsed before ctx was done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// durationMS converts d to fractional milliseconds for JSON output.
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// runChecks executes checks concurrently, bounded by server.max_concurrency.
+// Results keep the order of checks. Checks that have not finished when ctx is
+// done are reported as unhealthy with errDeadlineExceeded.
+func runChecks(ctx context.Context, cfg *Config, checks []PortCheck) []PortCheckResult {
+	concurrency := cfg.Server.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrency
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  = make([]PortCheckResult, len(checks))
+		finished = make([]bool, len(checks))
+		closed   bool
+		sem      = make(chan struct{}, concurrency)
+	)
+
+	for i, portCheck := range checks {
+		wg.Add(1)
+		go func(i int, portCheck PortCheck) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			result := runCheck(ctx, cfg, portCheck)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !closed {
+				results[i] = result
+				finished[i] = true
+			}
+		}(i, portCheck)
+	}
 
-		err := checkPort(portCheck.Host, portCheck.Port, timeout)
-		if err != nil {
-			result.Status = "unhealthy"
-			result.Error = err.Error()
-			allHealthy = false
-			failedPorts = append(failedPorts, fmt.Sprintf("%s (%s:%d)", portCheck.Name, portCheck.Host, portCheck.Port))
-		} else {
-			result.Status = "healthy"
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	closed = true
+	for i, portCheck := range checks {
+		if !finished[i] {
+			results[i] = newResult(portCheck)
+			results[i].Status = "unhealthy"
+			results[i].Error = errDeadlineExceeded.Error()
+			results[i].CheckedAt = time.Now().Format(time.RFC3339)
 		}
+	}
 
-		results = append(results, result)
+	return results
+}
+
+func performHealthCheck(cfg *Config) HealthStatus {
+	ctx := context.Background()
+	if cfg.Server.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Server.Deadline)
+		defer cancel()
+	}
+
+	return buildHealthStatus(runChecks(ctx, cfg, cfg.Checks))
+}
+
+// buildHealthStatus aggregates individual check results into the overall status.
+// A failed critical check makes the status unhealthy and a failed warning
+// check makes it degraded. Failed info checks are listed in the message but
+// do not change the status. A degraded result, e.g. a slow response, counts
+// as a failed warning check unless its severity is info.
+func buildHealthStatus(results []PortCheckResult) HealthStatus {
+	failed := map[string][]string{}
+
+	for _, result := range results {
+		if result.Status != "healthy" {
+			severity := result.Severity
+			if severity == "" {
+				severity = severityCritical
+			}
+			if result.Status == "degraded" && severity == severityCritical {
+				severity = severityWarning
+			}
+			failed[severity] = append(failed[severity], fmt.Sprintf("%s (%s:%d)", result.Name, result.Host, result.Port))
+		}
 	}
 
 	status := HealthStatus{
@@ -57,13 +340,27 @@ func performHealthCheck(cfg *Config) HealthStatus {
 		Version: appVersion,
 	}
 
-	if allHealthy {
+	switch {
+	case len(failed[severityCritical]) > 0:
+		status.Status = "unhealthy"
+	case len(failed[severityWarning]) > 0:
+		status.Status = "degraded"
+	default:
 		status.Status = "healthy"
+	}
+
+	if len(failed) == 0 {
 		status.Message = "All ports are listening and accessible"
-	} else {
-		status.Status = "unhealthy"
-		status.Message = fmt.Sprintf("Failed ports: %v", failedPorts)
+		return status
+	}
+
+	groups := []string{}
+	for _, severity := range []string{severityCritical, severityWarning, severityInfo} {
+		if len(failed[severity]) > 0 {
+			groups = append(groups, fmt.Sprintf("%s: %v", severity, failed[severity]))
+		}
 	}
+	status.Message = "Failed ports: " + strings.Join(groups, ", ")
 
 	return status
 }
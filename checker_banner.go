@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBannerLength limits the banner reported in PortCheckResult.
+	maxBannerLength = 128
+	// maxBannerRead limits how much data is read while waiting for expect.
+	maxBannerRead = 64 << 10
+)
+
+// checkBanner connects to host:port over TCP, optionally writes
+// portCheck.Send and then reads until portCheck.Expect matches or the
+// timeout passes. The received banner is recorded in result.
+func checkBanner(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	var expect *regexp.Regexp
+	if portCheck.Expect != "" {
+		re, err := regexp.Compile(portCheck.Expect)
+		if err != nil {
+			return fmt.Errorf("invalid expect pattern: %w", err)
+		}
+		expect = re
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialTimed(ctx, &dialer, "tcp", fmt.Sprintf("%s:%d", portCheck.Host, portCheck.Port), result)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if portCheck.Send != "" {
+		if _, err := conn.Write([]byte(portCheck.Send)); err != nil {
+			return fmt.Errorf("failed to send: %w", err)
+		}
+	}
+
+	return readExpected(conn, expect, portCheck.Send != "", result)
+}
+
+// readExpected reads from conn until expect matches the received data. With a
+// nil expect the first chunk of data, if any, is recorded and the check passes;
+// when a request was sent, some response is required, so a hung daemon fails.
+func readExpected(conn net.Conn, expect *regexp.Regexp, sent bool, result *PortCheckResult) error {
+	var received []byte
+	buf := make([]byte, 4096)
+
+	for len(received) < maxBannerRead {
+		n, err := conn.Read(buf)
+		received = append(received, buf[:n]...)
+
+		if expect == nil {
+			result.Banner = truncateBanner(received)
+			if err != nil && !isTimeout(err) && !errors.Is(err, io.EOF) {
+				return err
+			}
+			if sent && len(received) == 0 {
+				if isTimeout(err) {
+					return errors.New("no response received before timeout")
+				}
+				return errors.New("connection closed without a response")
+			}
+			return nil
+		}
+
+		if loc := expect.FindIndex(received); loc != nil {
+			result.Banner = truncateBanner(bannerLine(received, loc))
+			return nil
+		}
+
+		if err != nil {
+			result.Banner = truncateBanner(received)
+			if isTimeout(err) {
+				return fmt.Errorf("expected %q not received before timeout", expect.String())
+			}
+			return fmt.Errorf("expected %q not received: %w", expect.String(), err)
+		}
+	}
+
+	result.Banner = truncateBanner(received)
+	return fmt.Errorf("expected %q not found in first %d bytes", expect.String(), maxBannerRead)
+}
+
+// bannerLine returns the line(s) of data covering the match at loc.
+func bannerLine(data []byte, loc []int) []byte {
+	start := bytes.LastIndexByte(data[:loc[0]], '\n') + 1
+	end := len(data)
+	if i := bytes.IndexByte(data[loc[1]:], '\n'); i >= 0 {
+		end = loc[1] + i
+	}
+	return data[start:end]
+}
+
+// truncateBanner trims whitespace and limits the banner to maxBannerLength.
+func truncateBanner(data []byte) string {
+	banner := strings.TrimSpace(string(data))
+	if len(banner) > maxBannerLength {
+		banner = banner[:maxBannerLength] + "..."
+	}
+	return banner
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startBannerServer starts a listener that runs serve on every connection.
+func startBannerServer(t *testing.T, serve func(conn net.Conn)) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				serve(conn)
+			}()
+		}
+	}()
+
+	var port int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &port)
+	return port
+}
+
+func TestCheckBanner(t *testing.T) {
+	sshPort := startBannerServer(t, func(conn net.Conn) {
+		_, _ = fmt.Fprint(conn, "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n")
+		time.Sleep(500 * time.Millisecond)
+	})
+	smtpPort := startBannerServer(t, func(conn net.Conn) {
+		// Banner arrives in pieces
+		_, _ = fmt.Fprint(conn, "220 mail.example.com")
+		time.Sleep(20 * time.Millisecond)
+		_, _ = fmt.Fprint(conn, " ESMTP Postfix\r\n")
+		time.Sleep(500 * time.Millisecond)
+	})
+	hungPort := startBannerServer(t, func(_ net.Conn) {
+		time.Sleep(time.Second)
+	})
+	echoPort := startBannerServer(t, func(conn net.Conn) {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		_, _ = fmt.Fprintf(conn, "+PONG %s", line)
+	})
+	longPort := startBannerServer(t, func(conn net.Conn) {
+		_, _ = fmt.Fprintf(conn, "220 %s\r\n", strings.Repeat("x", 500))
+	})
+
+	tests := []struct {
+		name       string
+		port       int
+		send       string
+		expect     string
+		wantErr    string
+		wantBanner string
+	}{
+		{
+			name:       "SSH banner",
+			port:       sshPort,
+			expect:     `^SSH-2\.0-`,
+			wantBanner: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+		},
+		{
+			name:       "banner split across reads",
+			port:       smtpPort,
+			expect:     `^220 .*ESMTP`,
+			wantBanner: "220 mail.example.com ESMTP Postfix",
+		},
+		{
+			name:       "wrong banner",
+			port:       sshPort,
+			expect:     `^220 `,
+			wantErr:    "not received",
+			wantBanner: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+		},
+		{
+			name:    "hung daemon accepts but never greets",
+			port:    hungPort,
+			expect:  `^220 `,
+			wantErr: "not received before timeout",
+		},
+		{
+			name:       "send and expect",
+			port:       echoPort,
+			send:       "PING\r\n",
+			expect:     `\+PONG`,
+			wantBanner: "+PONG PING",
+		},
+		{
+			name:       "send without expect",
+			port:       echoPort,
+			send:       "PING\r\n",
+			wantBanner: "+PONG PING",
+		},
+		{
+			name:    "send to hung daemon",
+			port:    hungPort,
+			send:    "PING\r\n",
+			wantErr: "no response received before timeout",
+		},
+		{
+			name:       "long banner is truncated",
+			port:       longPort,
+			expect:     `^220 x+`,
+			wantBanner: "220 " + strings.Repeat("x", maxBannerLength-4) + "...",
+		},
+		{
+			name:    "invalid pattern",
+			port:    sshPort,
+			expect:  `(`,
+			wantErr: "invalid expect pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portCheck := PortCheck{Host: "127.0.0.1", Port: tt.port, Send: tt.send, Expect: tt.expect}
+
+			var result PortCheckResult
+			err := checkBanner(context.Background(), portCheck, 300*time.Millisecond, &result)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkBanner() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkBanner() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if result.Banner != tt.wantBanner {
+				t.Errorf("Banner = %q, want %q", result.Banner, tt.wantBanner)
+			}
+		})
+	}
+}
+
+func TestPerformHealthCheckWithExpect(t *testing.T) {
+	port := startBannerServer(t, func(conn net.Conn) {
+		_, _ = fmt.Fprint(conn, "* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n")
+	})
+
+	cfg := &Config{
+		Server: ServerConfig{Timeout: time.Second},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: port, Name: "IMAP", Expect: `^\* OK`},
+		},
+	}
+
+	status := performHealthCheck(cfg)
+
+	if status.Checks[0].Status != "healthy" {
+		t.Errorf("Status = %q, want 'healthy' (error: %s)", status.Checks[0].Status, status.Checks[0].Error)
+	}
+	if status.Checks[0].Banner != "* OK [CAPABILITY IMAP4rev1] Dovecot ready." {
+		t.Errorf("Banner = %q", status.Checks[0].Banner)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS record types supported by DNS checks.
+var dnsRecordTypes = map[string]uint16{
+	"A":     1,
+	"CNAME": 5,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+}
+
+var dnsRcodeNames = map[int]string{
+	0: "NOERROR",
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+const (
+	dnsClassIN      = 1
+	dnsHeaderLength = 12
+	dnsFlagRD       = 1 << 8
+	dnsFlagTC       = 1 << 9
+	dnsFlagQR       = 1 << 15
+	defaultDNSPort  = 53
+)
+
+// checkDNS queries the DNS server at host:port for portCheck.DNS.Query and
+// verifies the rcode and the answers. The rcode and answers are recorded in
+// result even when the check fails.
+func checkDNS(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	dnsCheck := portCheck.DNS
+	if dnsCheck == nil || dnsCheck.Query == "" {
+		return errors.New("dns check requires dns.query")
+	}
+
+	recordType := strings.ToUpper(dnsCheck.RecordType)
+	if recordType == "" {
+		recordType = "A"
+	}
+	qtype, ok := dnsRecordTypes[recordType]
+	if !ok {
+		return fmt.Errorf("unsupported record type %q", dnsCheck.RecordType)
+	}
+
+	protocol := dnsCheck.Protocol
+	if protocol == "" {
+		protocol = protocolUDP
+	}
+	if protocol != protocolUDP && protocol != protocolTCP {
+		return fmt.Errorf("unknown dns protocol %q", dnsCheck.Protocol)
+	}
+
+	port := portCheck.Port
+	if port == 0 {
+		port = defaultDNSPort
+	}
+	address := fmt.Sprintf("%s:%d", portCheck.Host, port)
+
+	query, id, err := buildDNSQuery(dnsCheck.Query, qtype)
+	if err != nil {
+		return err
+	}
+
+	response, err := exchangeDNS(ctx, protocol, address, query, timeout, result)
+	if err == nil && protocol == protocolUDP && len(response) >= dnsHeaderLength &&
+		binary.BigEndian.Uint16(response[2:])&dnsFlagTC != 0 {
+		// Truncated over UDP, retry over TCP like a stub resolver would
+		response, err = exchangeDNS(ctx, protocolTCP, address, query, timeout, result)
+	}
+	if err != nil {
+		return err
+	}
+
+	rcode, answers, err := parseDNSResponse(response, id, qtype)
+	if err != nil {
+		return err
+	}
+
+	result.DNS = &DNSResult{Rcode: rcodeName(rcode), Answers: answers}
+
+	if rcode != 0 {
+		return fmt.Errorf("query for %s %s returned %s", dnsCheck.Query, recordType, rcodeName(rcode))
+	}
+
+	minAnswers := dnsCheck.MinAnswers
+	if minAnswers == 0 && len(dnsCheck.Expected) == 0 {
+		minAnswers = 1
+	}
+	if len(answers) < minAnswers {
+		return fmt.Errorf("got %d %s answers, want at least %d", len(answers), recordType, minAnswers)
+	}
+
+	for _, expected := range dnsCheck.Expected {
+		if !containsAnswer(answers, expected, recordType) {
+			return fmt.Errorf("expected answer %q not found in %v", expected, answers)
+		}
+	}
+
+	return nil
+}
+
+// exchangeDNS sends query to address and returns the raw response.
+// Messages over TCP are prefixed with their two byte length.
+func exchangeDNS(ctx context.Context, protocol, address string, query []byte, timeout time.Duration, result *PortCheckResult) ([]byte, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialTimed(ctx, &dialer, protocol, address, result)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if protocol == protocolUDP {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// buildDNSQuery encodes a recursive query for name and qtype.
+func buildDNSQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	encodedName, err := encodeDNSName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msg := make([]byte, dnsHeaderLength, dnsHeaderLength+len(encodedName)+4)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRD)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	msg = append(msg, encodedName...)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg, id, nil
+}
+
+// encodeDNSName encodes name as a sequence of length-prefixed labels.
+func encodeDNSName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	var encoded []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid dns name %q", name)
+			}
+			encoded = append(encoded, byte(len(label)))
+			encoded = append(encoded, label...)
+		}
+	}
+	return append(encoded, 0), nil
+}
+
+// parseDNSResponse validates the response header against id and returns the
+// rcode and the answers of type qtype rendered as strings.
+func parseDNSResponse(msg []byte, id, qtype uint16) (int, []string, error) {
+	if len(msg) < dnsHeaderLength {
+		return 0, nil, errors.New("dns response too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return 0, nil, errors.New("dns response id mismatch")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&dnsFlagQR == 0 {
+		return 0, nil, errors.New("dns message is not a response")
+	}
+	rcode := int(flags & 0x0f)
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	offset := dnsHeaderLength
+	for i := 0; i < qdcount; i++ {
+		_, next, err := decodeDNSName(msg, offset)
+		if err != nil {
+			return rcode, nil, err
+		}
+		offset = next + 4
+	}
+
+	answers := []string{}
+	for i := 0; i < ancount; i++ {
+		_, next, err := decodeDNSName(msg, offset)
+		if err != nil {
+			return rcode, nil, err
+		}
+		if next+10 > len(msg) {
+			return rcode, nil, errors.New("dns answer truncated")
+		}
+		rrtype := binary.BigEndian.Uint16(msg[next:])
+		rdlength := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rdata := next + 10
+		if rdata+rdlength > len(msg) {
+			return rcode, nil, errors.New("dns answer truncated")
+		}
+		offset = rdata + rdlength
+
+		if rrtype != qtype {
+			continue
+		}
+		answer, err := formatDNSRecord(msg, rrtype, rdata, rdlength)
+		if err != nil {
+			return rcode, nil, err
+		}
+		answers = append(answers, answer)
+	}
+
+	return rcode, answers, nil
+}
+
+// formatDNSRecord renders the rdata of a record in presentation format.
+func formatDNSRecord(msg []byte, rrtype uint16, offset, length int) (string, error) {
+	rdata := msg[offset : offset+length]
+	switch rrtype {
+	case dnsRecordTypes["A"], dnsRecordTypes["AAAA"]:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			return "", errors.New("invalid address record")
+		}
+		return net.IP(rdata).String(), nil
+	case dnsRecordTypes["CNAME"]:
+		name, _, err := decodeDNSName(msg, offset)
+		return name, err
+	case dnsRecordTypes["MX"]:
+		if len(rdata) < 3 {
+			return "", errors.New("invalid MX record")
+		}
+		name, _, err := decodeDNSName(msg, offset+2)
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rdata), name), err
+	case dnsRecordTypes["SRV"]:
+		if len(rdata) < 7 {
+			return "", errors.New("invalid SRV record")
+		}
+		name, _, err := decodeDNSName(msg, offset+6)
+		return fmt.Sprintf("%d %d %d %s",
+			binary.BigEndian.Uint16(rdata[0:]),
+			binary.BigEndian.Uint16(rdata[2:]),
+			binary.BigEndian.Uint16(rdata[4:]),
+			name), err
+	case dnsRecordTypes["TXT"]:
+		var parts []string
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				return "", errors.New("invalid TXT record")
+			}
+			parts = append(parts, string(rdata[i+1:i+1+n]))
+			i += 1 + n
+		}
+		return strings.Join(parts, ""), nil
+	}
+	return "", fmt.Errorf("unsupported record type %d", rrtype)
+}
+
+// decodeDNSName decodes a possibly compressed name starting at offset and
+// returns it in lower case without the trailing dot, along with the offset
+// right after the name in the original position.
+func decodeDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("dns name out of bounds")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errors.New("dns name out of bounds")
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("dns name compression loop")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errors.New("dns name out of bounds")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+func rcodeName(rcode int) string {
+	if name, ok := dnsRcodeNames[rcode]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(rcode)
+}
+
+// containsAnswer reports whether answers of recordType contain expected.
+// TXT data must match exactly; other records hold names and addresses, which
+// are compared case-insensitively, ignoring trailing dots.
+func containsAnswer(answers []string, expected, recordType string) bool {
+	if recordType != "TXT" {
+		expected = strings.TrimSuffix(expected, ".")
+	}
+	for _, answer := range answers {
+		if answer == expected || (recordType != "TXT" && strings.EqualFold(answer, expected)) {
+			return true
+		}
+	}
+	return false
+}
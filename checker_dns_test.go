@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDNSRecord is a record served by the fake DNS server.
+type fakeDNSRecord struct {
+	rrtype uint16
+	rdata  func(msg []byte) []byte
+}
+
+func mustEncodeName(t *testing.T, name string) []byte {
+	t.Helper()
+	encoded, err := encodeDNSName(name)
+	if err != nil {
+		t.Fatalf("encodeDNSName(%q): %v", name, err)
+	}
+	return encoded
+}
+
+// fakeDNSResponse answers query from zone, keyed by lower-case name.
+// Unknown names get NXDOMAIN. Answer owners point to the question name.
+func fakeDNSResponse(query []byte, zone map[string][]fakeDNSRecord, truncate bool) []byte {
+	name, next, err := decodeDNSName(query, dnsHeaderLength)
+	if err != nil {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[next:])
+
+	records, found := zone[name]
+	var answers [][]byte
+	for _, record := range records {
+		if record.rrtype != qtype {
+			continue
+		}
+		answer := []byte{0xc0, dnsHeaderLength} // pointer to question name
+		answer = binary.BigEndian.AppendUint16(answer, record.rrtype)
+		answer = binary.BigEndian.AppendUint16(answer, dnsClassIN)
+		answer = binary.BigEndian.AppendUint32(answer, 300)
+		rdata := record.rdata(query)
+		answer = binary.BigEndian.AppendUint16(answer, uint16(len(rdata)))
+		answers = append(answers, append(answer, rdata...))
+	}
+
+	flags := uint16(dnsFlagQR | dnsFlagRD)
+	if !found {
+		flags |= 3 // NXDOMAIN
+	}
+	if truncate {
+		flags |= dnsFlagTC
+		answers = nil
+	}
+
+	response := make([]byte, dnsHeaderLength)
+	copy(response, query[:2])
+	binary.BigEndian.PutUint16(response[2:], flags)
+	binary.BigEndian.PutUint16(response[4:], 1)
+	binary.BigEndian.PutUint16(response[6:], uint16(len(answers)))
+	response = append(response, query[dnsHeaderLength:next+4]...)
+	for _, answer := range answers {
+		response = append(response, answer...)
+	}
+	return response
+}
+
+// startFakeDNSServer serves zone on the same port over UDP and TCP.
+// With truncateUDP set, UDP responses have the TC bit set and no answers.
+func startFakeDNSServer(t *testing.T, zone map[string][]fakeDNSRecord, truncateUDP bool) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start DNS TCP server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	packetConn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to start DNS UDP server: %v", err)
+	}
+	t.Cleanup(func() { _ = packetConn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := fakeDNSResponse(buf[:n], zone, truncateUDP); response != nil {
+				_, _ = packetConn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				response := fakeDNSResponse(query, zone, false)
+				_, _ = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(response))))
+				_, _ = conn.Write(response)
+			}()
+		}
+	}()
+
+	var port int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &port)
+	return port
+}
+
+func testZone(t *testing.T) map[string][]fakeDNSRecord {
+	static := func(data []byte) func([]byte) []byte {
+		return func([]byte) []byte { return data }
+	}
+	return map[string][]fakeDNSRecord{
+		"example.com": {
+			{rrtype: 1, rdata: static([]byte{192, 0, 2, 10})},
+			{rrtype: 1, rdata: static([]byte{192, 0, 2, 11})},
+			{rrtype: 28, rdata: static(net.ParseIP("2001:db8::10"))},
+			{rrtype: 15, rdata: func([]byte) []byte {
+				return append([]byte{0, 10}, mustEncodeName(t, "mail.example.com")...)
+			}},
+			{rrtype: 16, rdata: static(append([]byte{12}, "v=spf1 -all "...))},
+		},
+		"_sip._tcp.example.com": {
+			{rrtype: 33, rdata: func([]byte) []byte {
+				return append([]byte{0, 10, 0, 5, 0x13, 0xc4}, mustEncodeName(t, "sip.example.com")...)
+			}},
+		},
+		"www.example.com": {
+			// Compressed target pointing to the "example.com" suffix of the question
+			{rrtype: 5, rdata: func([]byte) []byte { return []byte{0xc0, dnsHeaderLength + 4} }},
+		},
+		"mail._domainkey.example.com": {
+			{rrtype: 16, rdata: static(append([]byte{14}, "v=DKIM1; p=ABC"...))},
+		},
+		"empty.example.com": {},
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	port := startFakeDNSServer(t, testZone(t), false)
+
+	tests := []struct {
+		name        string
+		dnsCheck    *DNSCheck
+		wantErr     string
+		wantRcode   string
+		wantAnswers []string
+	}{
+		{
+			name:        "A records",
+			dnsCheck:    &DNSCheck{Query: "example.com"},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:        "expected answer present",
+			dnsCheck:    &DNSCheck{Query: "EXAMPLE.com.", RecordType: "a", Expected: []string{"192.0.2.11"}},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:        "expected answer missing",
+			dnsCheck:    &DNSCheck{Query: "example.com", Expected: []string{"192.0.2.99"}},
+			wantErr:     `expected answer "192.0.2.99" not found`,
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:        "minimum answer count",
+			dnsCheck:    &DNSCheck{Query: "example.com", MinAnswers: 3},
+			wantErr:     "got 2 A answers, want at least 3",
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:        "AAAA record",
+			dnsCheck:    &DNSCheck{Query: "example.com", RecordType: "AAAA"},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"2001:db8::10"},
+		},
+		{
+			name:        "MX record",
+			dnsCheck:    &DNSCheck{Query: "example.com", RecordType: "MX", Expected: []string{"10 mail.example.com."}},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"10 mail.example.com"},
+		},
+		{
+			name:        "SRV record",
+			dnsCheck:    &DNSCheck{Query: "_sip._tcp.example.com", RecordType: "SRV"},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"10 5 5060 sip.example.com"},
+		},
+		{
+			name:        "TXT record",
+			dnsCheck:    &DNSCheck{Query: "example.com", RecordType: "TXT", Expected: []string{"v=spf1 -all "}},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"v=spf1 -all "},
+		},
+		{
+			name:        "mixed-case TXT record",
+			dnsCheck:    &DNSCheck{Query: "mail._domainkey.example.com", RecordType: "TXT", Expected: []string{"v=DKIM1; p=ABC"}},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"v=DKIM1; p=ABC"},
+		},
+		{
+			name:        "TXT record is case-sensitive",
+			dnsCheck:    &DNSCheck{Query: "mail._domainkey.example.com", RecordType: "TXT", Expected: []string{"v=dkim1; p=abc"}},
+			wantErr:     `expected answer "v=dkim1; p=abc" not found`,
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"v=DKIM1; p=ABC"},
+		},
+		{
+			name:        "names are case-insensitive",
+			dnsCheck:    &DNSCheck{Query: "example.com", RecordType: "MX", Expected: []string{"10 Mail.Example.COM."}},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"10 mail.example.com"},
+		},
+		{
+			name:        "compressed CNAME",
+			dnsCheck:    &DNSCheck{Query: "www.example.com", RecordType: "CNAME"},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"example.com"},
+		},
+		{
+			name:        "over TCP",
+			dnsCheck:    &DNSCheck{Query: "example.com", Protocol: protocolTCP, MinAnswers: 2},
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:        "NXDOMAIN",
+			dnsCheck:    &DNSCheck{Query: "missing.example.com"},
+			wantErr:     "returned NXDOMAIN",
+			wantRcode:   "NXDOMAIN",
+			wantAnswers: []string{},
+		},
+		{
+			name:        "no answers",
+			dnsCheck:    &DNSCheck{Query: "empty.example.com"},
+			wantErr:     "got 0 A answers",
+			wantRcode:   "NOERROR",
+			wantAnswers: []string{},
+		},
+		{
+			name:     "unsupported record type",
+			dnsCheck: &DNSCheck{Query: "example.com", RecordType: "PTR"},
+			wantErr:  "unsupported record type",
+		},
+		{
+			name:     "missing query",
+			dnsCheck: &DNSCheck{},
+			wantErr:  "requires dns.query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portCheck := PortCheck{Host: "127.0.0.1", Port: port, Type: checkTypeDNS, DNS: tt.dnsCheck}
+
+			var result PortCheckResult
+			err := checkDNS(context.Background(), portCheck, time.Second, &result)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkDNS() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkDNS() error = %v, want error containing %q", err, tt.wantErr)
+			}
+
+			if tt.wantRcode == "" {
+				if result.DNS != nil {
+					t.Errorf("DNS result = %+v, want none", result.DNS)
+				}
+				return
+			}
+			if result.DNS == nil {
+				t.Fatal("DNS result missing")
+			}
+			if result.DNS.Rcode != tt.wantRcode {
+				t.Errorf("Rcode = %q, want %q", result.DNS.Rcode, tt.wantRcode)
+			}
+			if strings.Join(result.DNS.Answers, ",") != strings.Join(tt.wantAnswers, ",") {
+				t.Errorf("Answers = %v, want %v", result.DNS.Answers, tt.wantAnswers)
+			}
+		})
+	}
+}
+
+func TestCheckDNSTruncatedFallsBackToTCP(t *testing.T) {
+	port := startFakeDNSServer(t, testZone(t), true)
+
+	portCheck := PortCheck{Host: "127.0.0.1", Port: port, Type: checkTypeDNS, DNS: &DNSCheck{Query: "example.com"}}
+
+	var result PortCheckResult
+	if err := checkDNS(context.Background(), portCheck, time.Second, &result); err != nil {
+		t.Fatalf("checkDNS() unexpected error: %v", err)
+	}
+	if len(result.DNS.Answers) != 2 {
+		t.Errorf("Answers = %v, want 2 answers from TCP retry", result.DNS.Answers)
+	}
+}
+
+func TestCheckDNSNoServer(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Timeout: 300 * time.Millisecond},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: 1, Name: "Resolver", Type: checkTypeDNS, DNS: &DNSCheck{Query: "example.com"}},
+		},
+	}
+
+	status := performHealthCheck(cfg)
+
+	if status.Checks[0].Status != "unhealthy" {
+		t.Errorf("Status = %q, want 'unhealthy'", status.Checks[0].Status)
+	}
+	if status.Checks[0].DNS != nil {
+		t.Errorf("DNS result = %+v, want none without a response", status.Checks[0].DNS)
+	}
+}
+
+func TestDecodeDNSNameLoop(t *testing.T) {
+	msg := make([]byte, dnsHeaderLength+2)
+	msg[dnsHeaderLength] = 0xc0
+	msg[dnsHeaderLength+1] = dnsHeaderLength // points to itself
+
+	if _, _, err := decodeDNSName(msg, dnsHeaderLength); err == nil {
+		t.Error("Expected error for compression loop")
+	}
+}
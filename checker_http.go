@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxHTTPBodyBytes limits how much of a response body is read for matching.
+	maxHTTPBodyBytes = 1 << 20
+	// defaultMaxRedirects is used when redirects are followed without an explicit limit.
+	defaultMaxRedirects = 10
+)
+
+// checkHTTP performs an HTTP(S) request described by portCheck.HTTP and
+// verifies the response status code and, optionally, the response body.
+// The HTTP status code is recorded in result even when the check fails.
+func checkHTTP(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	httpCheck := portCheck.HTTP
+	if httpCheck == nil || httpCheck.URL == "" {
+		return errors.New("http check requires http.url")
+	}
+
+	method := httpCheck.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if httpCheck.Body != "" {
+		body = strings.NewReader(httpCheck.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, httpCheck.URL, body)
+	if err != nil {
+		return fmt.Errorf("invalid http request: %w", err)
+	}
+	for name, value := range httpCheck.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	if httpCheck.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	client := &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: redirectPolicy(httpCheck),
+	}
+
+	// Timings are taken from the first request, before any redirect. The
+	// trace hooks may run on the transport's dialing goroutines.
+	var mu sync.Mutex
+	var connect, firstByte time.Duration
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && connect == 0 {
+				connect = time.Since(start)
+			}
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if firstByte == 0 {
+				firstByte = time.Since(start)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := client.Do(req)
+	mu.Lock()
+	result.ConnectMS = durationMS(connect)
+	result.TTFBMS = durationMS(firstByte)
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	result.HTTPStatus = resp.StatusCode
+
+	if !expectedHTTPStatus(httpCheck.ExpectedStatus, resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if httpCheck.BodyContains == "" && httpCheck.BodyRegex == "" {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if httpCheck.BodyContains != "" && !strings.Contains(string(data), httpCheck.BodyContains) {
+		return fmt.Errorf("response body does not contain %q", httpCheck.BodyContains)
+	}
+
+	if httpCheck.BodyRegex != "" {
+		re, err := regexp.Compile(httpCheck.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body_regex: %w", err)
+		}
+		if !re.Match(data) {
+			return fmt.Errorf("response body does not match %q", httpCheck.BodyRegex)
+		}
+	}
+
+	return nil
+}
+
+// redirectPolicy returns the http.Client redirect policy for httpCheck.
+// Redirects are not followed unless follow_redirects is set, so a 3xx
+// response is evaluated against the expected status codes as-is.
+func redirectPolicy(httpCheck *HTTPCheck) func(*http.Request, []*http.Request) error {
+	if !httpCheck.FollowRedirects {
+		return func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	maxRedirects := httpCheck.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	return func(_ *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
+
+// expectedHTTPStatus reports whether code is acceptable. Without an explicit
+// list any 2xx or 3xx status is accepted.
+func expectedHTTPStatus(expected []int, code int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, want := range expected {
+		if code == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"status":"ok","version":"2.4.1"}`)
+	})
+	mux.HandleFunc("/bad-gateway", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		check      *HTTPCheck
+		timeout    time.Duration
+		wantErr    string
+		wantStatus int
+	}{
+		{
+			name:       "default accepts 2xx",
+			check:      &HTTPCheck{URL: server.URL + "/ok"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "5xx fails",
+			check:      &HTTPCheck{URL: server.URL + "/bad-gateway"},
+			wantErr:    "unexpected status code 502",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "explicit expected status",
+			check:      &HTTPCheck{URL: server.URL + "/bad-gateway", ExpectedStatus: []int{502}},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "redirect not followed by default",
+			check:      &HTTPCheck{URL: server.URL + "/redirect", ExpectedStatus: []int{200}},
+			wantErr:    "unexpected status code 302",
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "redirect followed",
+			check:      &HTTPCheck{URL: server.URL + "/redirect", ExpectedStatus: []int{200}, FollowRedirects: true},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "redirect limit",
+			check:   &HTTPCheck{URL: server.URL + "/loop", FollowRedirects: true, MaxRedirects: 3},
+			wantErr: "stopped after 3 redirects",
+		},
+		{
+			name:       "body contains",
+			check:      &HTTPCheck{URL: server.URL + "/ok", BodyContains: `"status":"ok"`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "body does not contain",
+			check:      &HTTPCheck{URL: server.URL + "/ok", BodyContains: "maintenance"},
+			wantErr:    "does not contain",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "body regex",
+			check:      &HTTPCheck{URL: server.URL + "/ok", BodyRegex: `"version":"2\.\d+`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "body regex mismatch",
+			check:      &HTTPCheck{URL: server.URL + "/ok", BodyRegex: `"version":"3\.`},
+			wantErr:    "does not match",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "method headers and body",
+			check: &HTTPCheck{
+				URL:          server.URL + "/echo",
+				Method:       http.MethodPost,
+				Headers:      map[string]string{"X-Token": "secret"},
+				Body:         "ping",
+				BodyContains: "ping",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "timeout",
+			check:   &HTTPCheck{URL: server.URL + "/slow"},
+			timeout: 100 * time.Millisecond,
+			wantErr: "Client.Timeout",
+		},
+		{
+			name:    "missing url",
+			check:   &HTTPCheck{},
+			wantErr: "requires http.url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 2 * time.Second
+			}
+
+			var result PortCheckResult
+			err := checkHTTP(context.Background(), PortCheck{Type: checkTypeHTTP, HTTP: tt.check}, timeout, &result)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkHTTP() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkHTTP() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if result.HTTPStatus != tt.wantStatus {
+				t.Errorf("HTTPStatus = %d, want %d", result.HTTPStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPerformHealthCheckHTTPType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Server: ServerConfig{Timeout: 2 * time.Second},
+		Checks: []PortCheck{
+			{Name: "App", Type: checkTypeHTTP, HTTP: &HTTPCheck{URL: server.URL + "/"}},
+			{Name: "Broken App", Type: checkTypeHTTP, HTTP: &HTTPCheck{URL: server.URL + "/down"}},
+		},
+	}
+
+	status := performHealthCheck(cfg)
+
+	if status.Status != "unhealthy" {
+		t.Errorf("Status = %q, want 'unhealthy'", status.Status)
+	}
+	if status.Checks[0].Status != "healthy" || status.Checks[0].HTTPStatus != http.StatusOK {
+		t.Errorf("Checks[0] = %+v, want healthy with status 200", status.Checks[0])
+	}
+	if status.Checks[1].Status != "unhealthy" || status.Checks[1].HTTPStatus != http.StatusBadGateway {
+		t.Errorf("Checks[1] = %+v, want unhealthy with status 502", status.Checks[1])
+	}
+	if status.Checks[0].LatencyMS <= 0 {
+		t.Errorf("LatencyMS = %v, want > 0", status.Checks[0].LatencyMS)
+	}
+	if status.Checks[0].ConnectMS <= 0 || status.Checks[0].TTFBMS < status.Checks[0].ConnectMS {
+		t.Errorf("ConnectMS = %v, TTFBMS = %v, want both set with TTFB after connect", status.Checks[0].ConnectMS, status.Checks[0].TTFBMS)
+	}
+}
+
+func TestPerformHealthCheckUnknownType(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Timeout: time.Second},
+		Checks: []PortCheck{{Name: "Mystery", Type: "gopher"}},
+	}
+
+	status := performHealthCheck(cfg)
+
+	if status.Checks[0].Status != "unhealthy" {
+		t.Errorf("Status = %q, want 'unhealthy'", status.Checks[0].Status)
+	}
+	if !strings.Contains(status.Checks[0].Error, "unknown check type") {
+		t.Errorf("Error = %q, want unknown check type", status.Checks[0].Error)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Supported values of TLSCheck.StartTLS.
+const (
+	startTLSSMTP  = "smtp"
+	startTLSIMAP  = "imap"
+	startTLSPOP3  = "pop3"
+	startTLSSieve = "sieve"
+)
+
+// startTLSConn wraps a plain text protocol connection before the TLS upgrade.
+type startTLSConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *startTLSConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *startTLSConn) writeLine(line string) error {
+	_, err := fmt.Fprintf(c.conn, "%s\r\n", line)
+	return err
+}
+
+// dialStartTLS connects to address, speaks the plain text preamble of
+// protocol up to a successful STARTTLS command and completes the TLS
+// handshake on the same connection.
+func dialStartTLS(ctx context.Context, address, protocol string, timeout time.Duration, config *tls.Config, result *PortCheckResult) (*tls.Conn, error) {
+	var negotiate func(*startTLSConn) error
+	switch protocol {
+	case startTLSSMTP:
+		negotiate = startTLSWithSMTP
+	case startTLSIMAP:
+		negotiate = startTLSWithIMAP
+	case startTLSPOP3:
+		negotiate = startTLSWithPOP3
+	case startTLSSieve:
+		negotiate = startTLSWithSieve
+	default:
+		return nil, fmt.Errorf("unsupported starttls protocol %q", protocol)
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialTimed(ctx, &dialer, "tcp", address, result)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if err := negotiate(&startTLSConn{conn: conn, reader: bufio.NewReader(conn)}); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s starttls: %w", protocol, err)
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// readSMTPReply reads a possibly multi-line SMTP reply and checks its code.
+func readSMTPReply(c *startTLSConn, code string) (string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+		if len(line) < 4 || line[:3] != code {
+			return "", fmt.Errorf("unexpected reply %q", line)
+		}
+		if line[3] != '-' {
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+}
+
+func startTLSWithSMTP(c *startTLSConn) error {
+	if _, err := readSMTPReply(c, "220"); err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if err := c.writeLine("EHLO portguard"); err != nil {
+		return err
+	}
+	capabilities, err := readSMTPReply(c, "250")
+	if err != nil {
+		return fmt.Errorf("EHLO: %w", err)
+	}
+	if !strings.Contains(strings.ToUpper(capabilities), "STARTTLS") {
+		return fmt.Errorf("STARTTLS not advertised")
+	}
+	if err := c.writeLine("STARTTLS"); err != nil {
+		return err
+	}
+	if _, err := readSMTPReply(c, "220"); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+	return nil
+}
+
+// readIMAPTagged reads untagged responses until the tagged completion for
+// tag and returns all lines. Anything other than OK is an error.
+func readIMAPTagged(c *startTLSConn, tag string) ([]string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, tag+" ") {
+			if !strings.HasPrefix(strings.ToUpper(line[len(tag)+1:]), "OK") {
+				return nil, fmt.Errorf("unexpected reply %q", line)
+			}
+			return lines, nil
+		}
+	}
+}
+
+func startTLSWithIMAP(c *startTLSConn) error {
+	greeting, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.HasPrefix(strings.ToUpper(greeting), "* OK") {
+		return fmt.Errorf("greeting: unexpected reply %q", greeting)
+	}
+
+	if err := c.writeLine("a1 CAPABILITY"); err != nil {
+		return err
+	}
+	lines, err := readIMAPTagged(c, "a1")
+	if err != nil {
+		return fmt.Errorf("CAPABILITY: %w", err)
+	}
+	if !strings.Contains(strings.ToUpper(strings.Join(lines, " ")), "STARTTLS") {
+		return fmt.Errorf("STARTTLS not advertised")
+	}
+
+	if err := c.writeLine("a2 STARTTLS"); err != nil {
+		return err
+	}
+	if _, err := readIMAPTagged(c, "a2"); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+	return nil
+}
+
+func startTLSWithPOP3(c *startTLSConn) error {
+	greeting, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("greeting: unexpected reply %q", greeting)
+	}
+	if err := c.writeLine("STLS"); err != nil {
+		return err
+	}
+	reply, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("STLS: %w", err)
+	}
+	if !strings.HasPrefix(reply, "+OK") {
+		return fmt.Errorf("STLS: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// readSieveResponse reads capability or data lines until the final OK, NO or
+// BYE response and returns all lines.
+func readSieveResponse(c *startTLSConn) ([]string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "OK"):
+			return lines, nil
+		case strings.HasPrefix(upper, "NO"), strings.HasPrefix(upper, "BYE"):
+			return nil, fmt.Errorf("unexpected reply %q", line)
+		}
+	}
+}
+
+func startTLSWithSieve(c *startTLSConn) error {
+	capabilities, err := readSieveResponse(c)
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.Contains(strings.ToUpper(strings.Join(capabilities, " ")), `"STARTTLS"`) {
+		return fmt.Errorf("STARTTLS not advertised")
+	}
+	if err := c.writeLine("STARTTLS"); err != nil {
+		return err
+	}
+	if _, err := readSieveResponse(c); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+	return nil
+}
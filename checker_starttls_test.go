@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDialogue scripts the plain text part of a fake STARTTLS server.
+// It returns false if the connection must not be upgraded to TLS.
+type fakeDialogue func(r *bufio.Reader, w net.Conn) bool
+
+// startFakeStartTLSServer starts a listener that runs dialogue on every
+// connection and then completes a TLS handshake with cert.
+func startFakeStartTLSServer(t *testing.T, cert tls.Certificate, dialogue fakeDialogue) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if !dialogue(bufio.NewReader(conn), conn) {
+					return
+				}
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				_ = tlsConn.Handshake()
+			}(conn)
+		}
+	}()
+
+	var port int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &port)
+	return port
+}
+
+// expectLine reads a line from r and reports whether it matches want.
+func expectLine(r *bufio.Reader, want string) bool {
+	line, err := r.ReadString('\n')
+	return err == nil && strings.TrimRight(line, "\r\n") == want
+}
+
+func fakeSMTP(advertise bool) fakeDialogue {
+	return func(r *bufio.Reader, w net.Conn) bool {
+		_, _ = fmt.Fprint(w, "220-mail.example.com ESMTP Postfix\r\n220 ready\r\n")
+		if !expectLine(r, "EHLO portguard") {
+			return false
+		}
+		_, _ = fmt.Fprint(w, "250-mail.example.com\r\n250-PIPELINING\r\n")
+		if advertise {
+			_, _ = fmt.Fprint(w, "250-STARTTLS\r\n")
+		}
+		_, _ = fmt.Fprint(w, "250 8BITMIME\r\n")
+		if !expectLine(r, "STARTTLS") {
+			return false
+		}
+		_, _ = fmt.Fprint(w, "220 2.0.0 Ready to start TLS\r\n")
+		return true
+	}
+}
+
+func fakeIMAP(r *bufio.Reader, w net.Conn) bool {
+	_, _ = fmt.Fprint(w, "* OK Dovecot ready.\r\n")
+	if !expectLine(r, "a1 CAPABILITY") {
+		return false
+	}
+	_, _ = fmt.Fprint(w, "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED\r\na1 OK Pre-login capabilities listed\r\n")
+	if !expectLine(r, "a2 STARTTLS") {
+		return false
+	}
+	_, _ = fmt.Fprint(w, "a2 OK Begin TLS negotiation now.\r\n")
+	return true
+}
+
+func fakePOP3(r *bufio.Reader, w net.Conn) bool {
+	_, _ = fmt.Fprint(w, "+OK Dovecot ready.\r\n")
+	if !expectLine(r, "STLS") {
+		return false
+	}
+	_, _ = fmt.Fprint(w, "+OK Begin TLS negotiation now.\r\n")
+	return true
+}
+
+func fakeSieve(r *bufio.Reader, w net.Conn) bool {
+	_, _ = fmt.Fprint(w, "\"IMPLEMENTATION\" \"Dovecot Pigeonhole\"\r\n\"SIEVE\" \"fileinto reject\"\r\n\"STARTTLS\"\r\nOK \"Dovecot ready.\"\r\n")
+	if !expectLine(r, "STARTTLS") {
+		return false
+	}
+	_, _ = fmt.Fprint(w, "OK \"Begin TLS negotiation now.\"\r\n")
+	return true
+}
+
+func TestCheckTLSWithStartTLS(t *testing.T) {
+	cert, caFile := newTestCertificate(t, time.Now().Add(10*24*time.Hour))
+
+	tests := []struct {
+		name        string
+		protocol    string
+		dialogue    fakeDialogue
+		tlsCheck    TLSCheck
+		wantErr     string
+		wantWarning bool
+	}{
+		{
+			name:     "SMTP",
+			protocol: startTLSSMTP,
+			dialogue: fakeSMTP(true),
+		},
+		{
+			name:     "SMTP without STARTTLS",
+			protocol: startTLSSMTP,
+			dialogue: fakeSMTP(false),
+			wantErr:  "STARTTLS not advertised",
+		},
+		{
+			name:     "IMAP",
+			protocol: startTLSIMAP,
+			dialogue: fakeIMAP,
+		},
+		{
+			name:     "POP3",
+			protocol: startTLSPOP3,
+			dialogue: fakePOP3,
+		},
+		{
+			name:     "ManageSieve",
+			protocol: startTLSSieve,
+			dialogue: fakeSieve,
+		},
+		{
+			name:        "expiry rules apply after upgrade",
+			protocol:    startTLSSMTP,
+			dialogue:    fakeSMTP(true),
+			tlsCheck:    TLSCheck{ExpiryWarningDays: 30},
+			wantWarning: true,
+		},
+		{
+			name:     "wrong protocol",
+			protocol: startTLSIMAP,
+			dialogue: fakePOP3,
+			wantErr:  "imap starttls: greeting",
+		},
+		{
+			name:     "unsupported protocol",
+			protocol: "ftp",
+			dialogue: fakePOP3,
+			wantErr:  "unsupported starttls protocol",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := startFakeStartTLSServer(t, cert, tt.dialogue)
+
+			tlsCheck := tt.tlsCheck
+			tlsCheck.StartTLS = tt.protocol
+			tlsCheck.CAFile = caFile
+			portCheck := PortCheck{Host: "127.0.0.1", Port: port, Type: checkTypeTLS, TLS: &tlsCheck}
+
+			var result PortCheckResult
+			err := checkTLS(context.Background(), portCheck, 2*time.Second, &result)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkTLS() unexpected error: %v", err)
+				}
+				if result.Certificate == nil || !strings.Contains(result.Certificate.Subject, "localhost") {
+					t.Errorf("Certificate = %+v, want details of the upgraded connection", result.Certificate)
+				}
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkTLS() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if (result.Warning != "") != tt.wantWarning {
+				t.Errorf("Warning = %q, want warning: %v", result.Warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCheckTLSWithStartTLSTimeout(t *testing.T) {
+	cert, _ := newTestCertificate(t, time.Now().Add(24*time.Hour))
+
+	// Server that never sends a greeting
+	port := startFakeStartTLSServer(t, cert, func(r *bufio.Reader, _ net.Conn) bool {
+		_, _ = r.ReadString('\n')
+		return false
+	})
+
+	portCheck := PortCheck{Host: "127.0.0.1", Port: port, Type: checkTypeTLS, TLS: &TLSCheck{StartTLS: startTLSSMTP}}
+
+	start := time.Now()
+	var result PortCheckResult
+	err := checkTLS(context.Background(), portCheck, 200*time.Millisecond, &result)
+
+	if err == nil {
+		t.Error("Expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Check took too long: %v", elapsed)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -298,6 +301,7 @@ func TestPerformHealthCheckResultDetails(t *testing.T) {
 				Port:        testPort,
 				Name:        "Test Service",
 				Description: "A test service",
+				Source:      "/etc/portguard/conf.d/team.yaml",
 			},
 		},
 	}
@@ -326,6 +330,10 @@ func TestPerformHealthCheckResultDetails(t *testing.T) {
 		t.Errorf("Result.Description = %q, want 'A test service'", result.Description)
 	}
 
+	if result.Source != "/etc/portguard/conf.d/team.yaml" {
+		t.Errorf("Result.Source = %q, want '/etc/portguard/conf.d/team.yaml'", result.Source)
+	}
+
 	if result.Status != "healthy" {
 		t.Errorf("Result.Status = %q, want 'healthy'", result.Status)
 	}
@@ -514,3 +522,385 @@ func TestPerformHealthCheckTimeoutBehavior(t *testing.T) {
 		})
 	}
 }
+
+func TestPerformHealthCheckPreservesOrder(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	var testPort int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &testPort)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	checks := make([]PortCheck, 20)
+	for i := range checks {
+		port := testPort
+		if i%3 == 0 {
+			port = 1 // Typically not listening
+		}
+		checks[i] = PortCheck{
+			Host: "127.0.0.1",
+			Port: port,
+			Name: fmt.Sprintf("Service %d", i),
+		}
+	}
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:        1 * time.Second,
+			MaxConcurrency: 4,
+		},
+		Checks: checks,
+	}
+
+	status := performHealthCheck(cfg)
+
+	if len(status.Checks) != len(checks) {
+		t.Fatalf("Expected %d check results, got %d", len(checks), len(status.Checks))
+	}
+
+	for i, result := range status.Checks {
+		if result.Name != checks[i].Name {
+			t.Errorf("Checks[%d].Name = %q, want %q", i, result.Name, checks[i].Name)
+		}
+		wantStatus := "healthy"
+		if i%3 == 0 {
+			wantStatus = "unhealthy"
+		}
+		if result.Status != wantStatus {
+			t.Errorf("Checks[%d].Status = %q, want %q", i, result.Status, wantStatus)
+		}
+	}
+}
+
+func TestPerformHealthCheckDeadlineExceeded(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:  5 * time.Second,
+			Deadline: time.Nanosecond,
+		},
+		Checks: []PortCheck{
+			{Host: "192.0.2.1", Port: 80, Name: "Slow 1"},
+			{Host: "192.0.2.2", Port: 80, Name: "Slow 2"},
+			{Host: "192.0.2.3", Port: 80, Name: "Slow 3"},
+		},
+	}
+
+	start := time.Now()
+	status := performHealthCheck(cfg)
+	elapsed := time.Since(start)
+
+	if elapsed > 1*time.Second {
+		t.Errorf("Health check took too long: %v (deadline was %v)", elapsed, cfg.Server.Deadline)
+	}
+
+	if status.Status != "unhealthy" {
+		t.Errorf("Status = %q, want 'unhealthy'", status.Status)
+	}
+
+	for i, result := range status.Checks {
+		if result.Name != cfg.Checks[i].Name {
+			t.Errorf("Checks[%d].Name = %q, want %q", i, result.Name, cfg.Checks[i].Name)
+		}
+		if result.Status != "unhealthy" {
+			t.Errorf("Checks[%d].Status = %q, want 'unhealthy'", i, result.Status)
+		}
+		if result.Error != "deadline exceeded" {
+			t.Errorf("Checks[%d].Error = %q, want 'deadline exceeded'", i, result.Error)
+		}
+	}
+}
+
+func TestRunChecksRespectsMaxConcurrency(t *testing.T) {
+	// The server holds every connection before greeting, so a check stays
+	// in flight until its greeting arrives.
+	var inFlight, peak atomic.Int32
+	testPort := startBannerServer(t, func(conn net.Conn) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		inFlight.Add(-1)
+		_, _ = fmt.Fprint(conn, "OK\r\n")
+	})
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:        2 * time.Second,
+			MaxConcurrency: 2,
+		},
+	}
+	for i := 1; i <= 6; i++ {
+		cfg.Checks = append(cfg.Checks, PortCheck{
+			Host:   "127.0.0.1",
+			Port:   testPort,
+			Name:   fmt.Sprintf("Service %d", i),
+			Expect: "^OK",
+		})
+	}
+
+	results := runChecks(context.Background(), cfg, cfg.Checks)
+
+	for i, result := range results {
+		if result.Status != "healthy" {
+			t.Errorf("Results[%d].Status = %q, want 'healthy' (error: %s)", i, result.Status, result.Error)
+		}
+	}
+	if got := peak.Load(); got != int32(cfg.Server.MaxConcurrency) {
+		t.Errorf("Peak checks in flight = %d, want %d", got, cfg.Server.MaxConcurrency)
+	}
+}
+
+func TestRunChecksRunsConcurrently(t *testing.T) {
+	// A hung daemon accepts the connection but never greets
+	testPort := startBannerServer(t, func(conn net.Conn) {
+		_, _ = conn.Read(make([]byte, 1))
+	})
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:        300 * time.Millisecond,
+			MaxConcurrency: 10,
+		},
+	}
+	for i := 1; i <= 8; i++ {
+		cfg.Checks = append(cfg.Checks, PortCheck{
+			Host:   "127.0.0.1",
+			Port:   testPort,
+			Name:   fmt.Sprintf("Service %d", i),
+			Expect: "^OK",
+		})
+	}
+
+	start := time.Now()
+	results := runChecks(context.Background(), cfg, cfg.Checks)
+	elapsed := time.Since(start)
+
+	// Sequential checks would take 8 timeouts (2.4s)
+	if elapsed > 3*cfg.Server.Timeout {
+		t.Errorf("8 slow checks took %v, want about one timeout (%v)", elapsed, cfg.Server.Timeout)
+	}
+	for i, result := range results {
+		if result.Status != "unhealthy" {
+			t.Errorf("Results[%d].Status = %q, want 'unhealthy'", i, result.Status)
+		}
+	}
+}
+
+func TestBuildHealthStatusSeverity(t *testing.T) {
+	result := func(name, severity, status string) PortCheckResult {
+		return PortCheckResult{Name: name, Host: "127.0.0.1", Port: 1, Severity: severity, Status: status}
+	}
+
+	tests := []struct {
+		name        string
+		results     []PortCheckResult
+		wantStatus  string
+		wantMessage string
+	}{
+		{
+			name:        "all healthy",
+			results:     []PortCheckResult{result("SMTP", severityCritical, "healthy")},
+			wantStatus:  "healthy",
+			wantMessage: "All ports are listening and accessible",
+		},
+		{
+			name: "critical failure",
+			results: []PortCheckResult{
+				result("SMTP", severityCritical, "unhealthy"),
+				result("Sieve", severityWarning, "unhealthy"),
+			},
+			wantStatus:  "unhealthy",
+			wantMessage: "Failed ports: critical: [SMTP (127.0.0.1:1)], warning: [Sieve (127.0.0.1:1)]",
+		},
+		{
+			name: "missing severity counts as critical",
+			results: []PortCheckResult{
+				result("SMTP", "", "unhealthy"),
+			},
+			wantStatus:  "unhealthy",
+			wantMessage: "Failed ports: critical: [SMTP (127.0.0.1:1)]",
+		},
+		{
+			name: "warning failure",
+			results: []PortCheckResult{
+				result("SMTP", severityCritical, "healthy"),
+				result("Sieve", severityWarning, "unhealthy"),
+				result("Docs", severityInfo, "unhealthy"),
+			},
+			wantStatus:  "degraded",
+			wantMessage: "Failed ports: warning: [Sieve (127.0.0.1:1)], info: [Docs (127.0.0.1:1)]",
+		},
+		{
+			name: "degraded critical check",
+			results: []PortCheckResult{
+				result("SMTP", severityCritical, "degraded"),
+				result("Docs", severityInfo, "degraded"),
+			},
+			wantStatus:  "degraded",
+			wantMessage: "Failed ports: warning: [SMTP (127.0.0.1:1)], info: [Docs (127.0.0.1:1)]",
+		},
+		{
+			name: "info failure only",
+			results: []PortCheckResult{
+				result("SMTP", severityCritical, "healthy"),
+				result("Docs", severityInfo, "unhealthy"),
+			},
+			wantStatus:  "healthy",
+			wantMessage: "Failed ports: info: [Docs (127.0.0.1:1)]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := buildHealthStatus(tt.results)
+			if status.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", status.Status, tt.wantStatus)
+			}
+			if status.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", status.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRunCheckRetries(t *testing.T) {
+	var connections atomic.Int32
+	port := startBannerServer(t, func(conn net.Conn) {
+		// Fail the first two connections, then answer properly
+		if connections.Add(1) <= 2 {
+			_, _ = conn.Write([]byte("421 busy\r\n"))
+			return
+		}
+		_, _ = conn.Write([]byte("220 ready\r\n"))
+	})
+
+	cfg := &Config{Server: ServerConfig{Timeout: time.Second}}
+
+	tests := []struct {
+		name              string
+		attempts          int
+		wantStatus        string
+		wantAttempts      int
+		wantAttemptErrors int
+	}{
+		{name: "single attempt", attempts: 0, wantStatus: "unhealthy", wantAttempts: 0, wantAttemptErrors: 0},
+		{name: "not enough attempts", attempts: 2, wantStatus: "unhealthy", wantAttempts: 2, wantAttemptErrors: 2},
+		{name: "succeeds on third attempt", attempts: 3, wantStatus: "healthy", wantAttempts: 3, wantAttemptErrors: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connections.Store(0)
+			portCheck := PortCheck{
+				Host:         "127.0.0.1",
+				Port:         port,
+				Name:         "SMTP",
+				Expect:       "^220",
+				Attempts:     tt.attempts,
+				RetryBackoff: time.Millisecond,
+			}
+
+			result := runCheck(context.Background(), cfg, portCheck)
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q (error: %s)", result.Status, tt.wantStatus, result.Error)
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", result.Attempts, tt.wantAttempts)
+			}
+			if len(result.AttemptErrors) != tt.wantAttemptErrors {
+				t.Errorf("AttemptErrors = %v, want %d entries", result.AttemptErrors, tt.wantAttemptErrors)
+			}
+			for _, attemptErr := range result.AttemptErrors {
+				if !strings.Contains(attemptErr, `expected "^220" not received`) {
+					t.Errorf("Attempt error %q should report the missing banner", attemptErr)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCheckRetriesStopAtDeadline(t *testing.T) {
+	cfg := &Config{Server: ServerConfig{Timeout: time.Second}}
+	portCheck := PortCheck{Host: "127.0.0.1", Port: 1, Name: "Closed", Attempts: 5, RetryBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := runCheck(ctx, cfg, portCheck)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runCheck took %v, backoff should stop at the deadline", elapsed)
+	}
+	if result.Error != errDeadlineExceeded.Error() {
+		t.Errorf("Error = %q, want %q", result.Error, errDeadlineExceeded)
+	}
+	if result.Attempts != 1 || len(result.AttemptErrors) != 1 {
+		t.Errorf("Attempts = %d with errors %v, want 1 attempt", result.Attempts, result.AttemptErrors)
+	}
+}
+
+func TestRunCheckLatency(t *testing.T) {
+	port := startBannerServer(t, func(conn net.Conn) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = conn.Write([]byte("220 ready\r\n"))
+	})
+
+	cfg := &Config{Server: ServerConfig{Timeout: time.Second}}
+
+	tests := []struct {
+		name        string
+		warnLatency time.Duration
+		maxLatency  time.Duration
+		wantStatus  string
+		wantMessage string
+	}{
+		{name: "no thresholds", wantStatus: "healthy"},
+		{name: "below thresholds", warnLatency: 500 * time.Millisecond, maxLatency: time.Second, wantStatus: "healthy"},
+		{name: "above warn_latency", warnLatency: 5 * time.Millisecond, maxLatency: time.Second, wantStatus: "degraded", wantMessage: "exceeds warn_latency 5ms"},
+		{name: "above max_latency", warnLatency: time.Millisecond, maxLatency: 5 * time.Millisecond, wantStatus: "unhealthy", wantMessage: "exceeds max_latency 5ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portCheck := PortCheck{
+				Host:        "127.0.0.1",
+				Port:        port,
+				Name:        "SMTP",
+				Expect:      "^220",
+				WarnLatency: tt.warnLatency,
+				MaxLatency:  tt.maxLatency,
+			}
+
+			result := runCheck(context.Background(), cfg, portCheck)
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q (error: %s)", result.Status, tt.wantStatus, result.Error)
+			}
+			if message := result.Error + result.Warning; !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("Error/Warning = %q, want it to contain %q", message, tt.wantMessage)
+			}
+			if result.ConnectMS <= 0 {
+				t.Errorf("ConnectMS = %v, want > 0", result.ConnectMS)
+			}
+			if result.TTFBMS < 20 || result.TTFBMS < result.ConnectMS {
+				t.Errorf("TTFBMS = %v, want at least 20ms and not below ConnectMS %v", result.TTFBMS, result.ConnectMS)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// checkTLS dials host:port, performs a TLS handshake with SNI and validates
+// the certificate chain and its expiry according to portCheck.TLS.
+// With tls.starttls set, the connection is upgraded using the protocol's
+// STARTTLS command first.
+func checkTLS(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	tlsCheck := portCheck.TLS
+	if tlsCheck == nil {
+		tlsCheck = &TLSCheck{}
+	}
+	serverName := tlsServerName(portCheck)
+
+	// The chain is verified in verifyTLSConnection so certificate details
+	// can be reported even when verification fails.
+	config := &tls.Config{ServerName: serverName, InsecureSkipVerify: true}
+	address := fmt.Sprintf("%s:%d", portCheck.Host, portCheck.Port)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var conn *tls.Conn
+	if tlsCheck.StartTLS != "" {
+		c, err := dialStartTLS(ctx, address, tlsCheck.StartTLS, timeout, config, result)
+		if err != nil {
+			return err
+		}
+		conn = c
+	} else {
+		c, err := dialTimed(ctx, &net.Dialer{Timeout: timeout}, "tcp", address, result)
+		if err != nil {
+			return err
+		}
+		conn = tls.Client(c, config)
+		if err := conn.HandshakeContext(ctx); err != nil {
+			_ = c.Close()
+			return err
+		}
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return verifyTLSConnection(conn.ConnectionState(), tlsCheck, serverName, result)
+}
+
+// tlsServerName returns the SNI name for portCheck, defaulting to its host.
+func tlsServerName(portCheck PortCheck) string {
+	if portCheck.TLS != nil && portCheck.TLS.ServerName != "" {
+		return portCheck.TLS.ServerName
+	}
+	return portCheck.Host
+}
+
+// verifyTLSConnection records the peer certificate in result, verifies the
+// chain against the system or configured CA bundle and applies the expiry
+// thresholds. A certificate within expiry_warning_days only sets a warning.
+func verifyTLSConnection(state tls.ConnectionState, tlsCheck *TLSCheck, serverName string, result *PortCheckResult) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	daysRemaining := int(time.Until(leaf.NotAfter).Hours() / 24)
+	result.Certificate = certificateInfo(leaf, daysRemaining)
+
+	if !tlsCheck.InsecureSkipVerify {
+		roots, err := loadCAPool(tlsCheck.CAFile)
+		if err != nil {
+			return err
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		}); err != nil {
+			return fmt.Errorf("certificate verification failed: %w", err)
+		}
+	}
+
+	if tlsCheck.ExpiryCriticalDays > 0 && daysRemaining < tlsCheck.ExpiryCriticalDays {
+		return fmt.Errorf("certificate expires in %d days (%s)", daysRemaining, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if tlsCheck.ExpiryWarningDays > 0 && daysRemaining < tlsCheck.ExpiryWarningDays {
+		result.Warning = fmt.Sprintf("certificate expires in %d days (%s)", daysRemaining, leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// loadCAPool returns the CA pool used for verification: the PEM bundle at
+// caFile if given, otherwise nil so the system roots are used.
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
+
+func certificateInfo(cert *x509.Certificate, daysRemaining int) *CertificateInfo {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	return &CertificateInfo{
+		Subject:       cert.Subject.String(),
+		Issuer:        cert.Issuer.String(),
+		SANs:          sans,
+		NotAfter:      cert.NotAfter.Format(time.RFC3339),
+		DaysRemaining: daysRemaining,
+	}
+}
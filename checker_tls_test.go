@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCertificate creates a self-signed certificate for localhost and
+// 127.0.0.1 that expires at notAfter. It returns the certificate and the path
+// of a CA bundle containing it.
+func newTestCertificate(t *testing.T, notAfter time.Time) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost", Organization: []string{"PortGuard Test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+// startTLSServer starts a TLS listener on 127.0.0.1 that completes the
+// handshake and closes each connection. It returns the listening port.
+func startTLSServer(t *testing.T, cert tls.Certificate) int {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Failed to start TLS server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	var port int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &port)
+	return port
+}
+
+func TestCheckTLS(t *testing.T) {
+	validCert, validCA := newTestCertificate(t, time.Now().Add(90*24*time.Hour))
+	expiringCert, expiringCA := newTestCertificate(t, time.Now().Add(5*24*time.Hour+time.Hour))
+
+	validPort := startTLSServer(t, validCert)
+	expiringPort := startTLSServer(t, expiringCert)
+
+	tests := []struct {
+		name        string
+		port        int
+		tlsCheck    *TLSCheck
+		wantErr     string
+		wantWarning bool
+	}{
+		{
+			name:     "valid chain with custom CA",
+			port:     validPort,
+			tlsCheck: &TLSCheck{CAFile: validCA, ServerName: "localhost"},
+		},
+		{
+			name:     "untrusted chain with system roots",
+			port:     validPort,
+			tlsCheck: &TLSCheck{ServerName: "localhost"},
+			wantErr:  "certificate verification failed",
+		},
+		{
+			name:     "insecure skip verify",
+			port:     validPort,
+			tlsCheck: &TLSCheck{InsecureSkipVerify: true},
+		},
+		{
+			name:     "SNI mismatch",
+			port:     validPort,
+			tlsCheck: &TLSCheck{CAFile: validCA, ServerName: "mail.example.com"},
+			wantErr:  "certificate verification failed",
+		},
+		{
+			name:        "expiry warning",
+			port:        expiringPort,
+			tlsCheck:    &TLSCheck{CAFile: expiringCA, ExpiryWarningDays: 14},
+			wantWarning: true,
+		},
+		{
+			name:     "expiry critical",
+			port:     expiringPort,
+			tlsCheck: &TLSCheck{CAFile: expiringCA, ExpiryWarningDays: 30, ExpiryCriticalDays: 7},
+			wantErr:  "certificate expires in 5 days",
+		},
+		{
+			name:     "missing CA file",
+			port:     validPort,
+			tlsCheck: &TLSCheck{CAFile: "/nonexistent/ca.pem"},
+			wantErr:  "failed to read CA file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portCheck := PortCheck{Host: "127.0.0.1", Port: tt.port, Type: checkTypeTLS, TLS: tt.tlsCheck}
+
+			var result PortCheckResult
+			err := checkTLS(context.Background(), portCheck, 2*time.Second, &result)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkTLS() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkTLS() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if (result.Warning != "") != tt.wantWarning {
+				t.Errorf("Warning = %q, want warning: %v", result.Warning, tt.wantWarning)
+			}
+			if result.Certificate == nil {
+				t.Fatal("Certificate details should be reported")
+			}
+		})
+	}
+}
+
+func TestCheckTLSCertificateDetails(t *testing.T) {
+	notAfter := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second)
+	cert, caFile := newTestCertificate(t, notAfter)
+	port := startTLSServer(t, cert)
+
+	cfg := &Config{
+		Server: ServerConfig{Timeout: 2 * time.Second},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: port, Name: "IMAPS", Type: checkTypeTLS, TLS: &TLSCheck{CAFile: caFile}},
+		},
+	}
+
+	status := performHealthCheck(cfg)
+	result := status.Checks[0]
+
+	if result.Status != "healthy" {
+		t.Fatalf("Status = %q, want 'healthy' (error: %s)", result.Status, result.Error)
+	}
+
+	info := result.Certificate
+	if info == nil {
+		t.Fatal("Certificate details missing")
+	}
+	if !strings.Contains(info.Subject, "CN=localhost") {
+		t.Errorf("Subject = %q, want CN=localhost", info.Subject)
+	}
+	if !strings.Contains(info.Issuer, "PortGuard Test") {
+		t.Errorf("Issuer = %q, want PortGuard Test", info.Issuer)
+	}
+	if strings.Join(info.SANs, ",") != "localhost,127.0.0.1" {
+		t.Errorf("SANs = %v, want [localhost 127.0.0.1]", info.SANs)
+	}
+	if info.NotAfter != notAfter.UTC().Format(time.RFC3339) {
+		t.Errorf("NotAfter = %q, want %q", info.NotAfter, notAfter.UTC().Format(time.RFC3339))
+	}
+	if info.DaysRemaining != 59 && info.DaysRemaining != 60 {
+		t.Errorf("DaysRemaining = %d, want ~60", info.DaysRemaining)
+	}
+}
+
+func TestCheckTLSConnectionRefused(t *testing.T) {
+	var result PortCheckResult
+	err := checkTLS(context.Background(), PortCheck{Host: "127.0.0.1", Port: 1}, time.Second, &result)
+	if err == nil {
+		t.Error("Expected error for closed port")
+	}
+	if result.Certificate != nil {
+		t.Error("Certificate should not be set without a handshake")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Supported values of PortCheck.Protocol.
+const (
+	protocolTCP = "tcp"
+	protocolUDP = "udp"
+)
+
+// udpBestEffortWait is how long a best effort check waits for an ICMP
+// "port unreachable" error after sending its datagram.
+const udpBestEffortWait = 200 * time.Millisecond
+
+// checkUDP sends the configured payload to host:port over UDP and waits for a
+// response that matches portCheck.Expect, if set. Best effort checks only
+// send the datagram and pass unless the host actively refuses it.
+func checkUDP(ctx context.Context, portCheck PortCheck, timeout time.Duration, result *PortCheckResult) error {
+	payload, err := udpPayload(portCheck)
+	if err != nil {
+		return err
+	}
+
+	var expect *regexp.Regexp
+	if portCheck.Expect != "" {
+		re, err := regexp.Compile(portCheck.Expect)
+		if err != nil {
+			return fmt.Errorf("invalid expect pattern: %w", err)
+		}
+		expect = re
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialTimed(ctx, &dialer, protocolUDP, fmt.Sprintf("%s:%d", portCheck.Host, portCheck.Port), result)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if portCheck.BestEffort {
+		result.BestEffort = true
+		if wait := time.Now().Add(udpBestEffortWait); wait.Before(deadline) {
+			deadline = wait
+		}
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("failed to send: %w", err)
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if isTimeout(err) {
+			if portCheck.BestEffort {
+				result.Warning = "best effort: datagram sent, no reply expected"
+				return nil
+			}
+			return fmt.Errorf("no response before timeout")
+		}
+		return err
+	}
+
+	response := buf[:n]
+	result.Banner = udpBanner(response)
+
+	if expect != nil && !expect.Match(response) {
+		return fmt.Errorf("response does not match %q", expect.String())
+	}
+	return nil
+}
+
+// udpPayload returns the datagram to send, decoding send_hex when set.
+func udpPayload(portCheck PortCheck) ([]byte, error) {
+	if portCheck.SendHex == "" {
+		return []byte(portCheck.Send), nil
+	}
+
+	payload, err := hex.DecodeString(strings.Join(strings.Fields(portCheck.SendHex), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid send_hex: %w", err)
+	}
+	return payload, nil
+}
+
+// udpBanner renders a response for the result: printable text as is,
+// binary data as a hex prefix.
+func udpBanner(response []byte) string {
+	if utf8.Valid(response) && strings.IndexFunc(string(response), isControl) < 0 {
+		return truncateBanner(response)
+	}
+
+	encoded := hex.EncodeToString(response)
+	if len(encoded) > maxBannerLength {
+		encoded = encoded[:maxBannerLength] + "..."
+	}
+	return "hex:" + encoded
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\r' && r != '\n' && r != '\t'
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startUDPServer starts a UDP listener that answers each datagram with the
+// result of reply, or stays silent when reply returns nil.
+func startUDPServer(t *testing.T, reply func(request []byte) []byte) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start UDP server: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := reply(buf[:n]); response != nil {
+				_, _ = conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	var port int
+	_, portStr, _ := net.SplitHostPort(conn.LocalAddr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &port)
+	return port
+}
+
+func TestCheckUDP(t *testing.T) {
+	echoPort := startUDPServer(t, func(request []byte) []byte {
+		return append([]byte("echo: "), request...)
+	})
+	binaryPort := startUDPServer(t, func(request []byte) []byte {
+		if !bytes.Equal(request, []byte{0x1b, 0x00, 0x00, 0x00}) {
+			return nil
+		}
+		return []byte{0x1c, 0x02, 0x03, 0xe8}
+	})
+	silentPort := startUDPServer(t, func([]byte) []byte { return nil })
+
+	tests := []struct {
+		name           string
+		portCheck      PortCheck
+		wantErr        string
+		wantBanner     string
+		wantBestEffort bool
+	}{
+		{
+			name:       "string payload with reply",
+			portCheck:  PortCheck{Port: echoPort, Send: "ping"},
+			wantBanner: "echo: ping",
+		},
+		{
+			name:       "reply matches expect",
+			portCheck:  PortCheck{Port: echoPort, Send: "ping", Expect: `^echo: ping$`},
+			wantBanner: "echo: ping",
+		},
+		{
+			name:       "reply does not match expect",
+			portCheck:  PortCheck{Port: echoPort, Send: "ping", Expect: `pong`},
+			wantErr:    "does not match",
+			wantBanner: "echo: ping",
+		},
+		{
+			name:       "hex payload with binary reply",
+			portCheck:  PortCheck{Port: binaryPort, SendHex: "1b 00 00 00", Expect: `^\x1c`},
+			wantBanner: "hex:1c0203e8",
+		},
+		{
+			name:      "invalid hex payload",
+			portCheck: PortCheck{Port: binaryPort, SendHex: "zz"},
+			wantErr:   "invalid send_hex",
+		},
+		{
+			name:      "no reply",
+			portCheck: PortCheck{Port: silentPort, Send: "ping"},
+			wantErr:   "no response before timeout",
+		},
+		{
+			name:           "best effort without reply",
+			portCheck:      PortCheck{Port: silentPort, Send: "<14>portguard test", BestEffort: true},
+			wantBestEffort: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portCheck := tt.portCheck
+			portCheck.Host = "127.0.0.1"
+			portCheck.Protocol = protocolUDP
+
+			var result PortCheckResult
+			err := checkUDP(context.Background(), portCheck, 300*time.Millisecond, &result)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkUDP() unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkUDP() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if result.Banner != tt.wantBanner {
+				t.Errorf("Banner = %q, want %q", result.Banner, tt.wantBanner)
+			}
+			if result.BestEffort != tt.wantBestEffort {
+				t.Errorf("BestEffort = %v, want %v", result.BestEffort, tt.wantBestEffort)
+			}
+			if tt.wantBestEffort && !strings.Contains(result.Warning, "best effort") {
+				t.Errorf("Warning = %q, want best effort note", result.Warning)
+			}
+		})
+	}
+}
+
+func TestPerformHealthCheckUDPProtocol(t *testing.T) {
+	port := startUDPServer(t, func(request []byte) []byte { return request })
+
+	cfg := &Config{
+		Server: ServerConfig{Timeout: 500 * time.Millisecond},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: port, Name: "Echo", Protocol: protocolUDP, Send: "hello"},
+			{Host: "127.0.0.1", Port: port, Name: "Bad protocol", Protocol: "sctp"},
+		},
+	}
+
+	status := performHealthCheck(cfg)
+
+	if status.Checks[0].Status != "healthy" {
+		t.Errorf("Checks[0].Status = %q, want 'healthy' (error: %s)", status.Checks[0].Status, status.Checks[0].Error)
+	}
+	if status.Checks[1].Status != "unhealthy" || !strings.Contains(status.Checks[1].Error, "unknown protocol") {
+		t.Errorf("Checks[1] = %+v, want unknown protocol error", status.Checks[1])
+	}
+}
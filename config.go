@@ -1,8 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -14,15 +23,24 @@ const (
 )
 
 func loadConfig(configPath string) (*Config, error) {
-	data, err := os.ReadFile(configPath)
+	var cfg Config
+	root, problems, err := decodeConfigFile(configPath, &cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
+	}
+	positions := newConfigPositions(root, "")
+	for i := range cfg.Checks {
+		cfg.Checks[i].Source = configPath
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := resolveSecrets(&cfg, filepath.Dir(configPath)); err != nil {
+		return nil, err
 	}
+	includeProblems, err := loadIncludes(&cfg, configPath, &positions)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, includeProblems...)
 
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = defaultListenPort
@@ -30,6 +48,335 @@ func loadConfig(configPath string) (*Config, error) {
 	if cfg.Server.Timeout == 0 {
 		cfg.Server.Timeout = 2 * time.Second
 	}
+	if cfg.Server.MaxConcurrency == 0 {
+		cfg.Server.MaxConcurrency = defaultMaxConcurrency
+	}
+	for i := range cfg.Checks {
+		applyCheckDefaults(&cfg.Checks[i])
+		// A check's files are relative to the file it is defined in, which
+		// may be an included fragment.
+		if tlsCheck := cfg.Checks[i].TLS; tlsCheck != nil {
+			tlsCheck.CAFile = resolveConfigPath(filepath.Dir(cfg.Checks[i].Source), tlsCheck.CAFile)
+		}
+	}
+	cfg.Notifications.DeadLetterFile = resolveConfigPath(filepath.Dir(configPath), cfg.Notifications.DeadLetterFile)
+	for _, notifierCfg := range cfg.Notifications.Notifiers {
+		if smtpCfg := notifierCfg.SMTP; smtpCfg != nil {
+			smtpCfg.CAFile = resolveConfigPath(filepath.Dir(configPath), smtpCfg.CAFile)
+		}
+		// A relative script path such as ./restart-postfix.sh is relative to
+		// the config file; a bare program name is still looked up in PATH.
+		if execCfg := notifierCfg.Exec; execCfg != nil && len(execCfg.Command) > 0 {
+			if path := execCfg.Command[0]; strings.ContainsRune(path, '/') && !filepath.IsAbs(path) {
+				execCfg.Command[0] = filepath.Join(filepath.Dir(configPath), path)
+			}
+		}
+	}
+
+	// Decoding problems are reported together with the validation errors,
+	// so a single run shows everything that is wrong with the file.
+	if err := validateConfig(&cfg, positions); err != nil {
+		var validationErrs configErrors
+		if !errors.As(err, &validationErrs) {
+			return nil, err
+		}
+		problems = append(problems, validationErrs...)
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
 
 	return &cfg, nil
 }
+
+// decodeConfigFile reads path, expands environment variables and decodes it
+// into out. The returned node tree gives the line positions of the fields for
+// validation errors. Unknown keys and values of the wrong type do not stop
+// decoding; they are returned as problems, to be reported together with the
+// validation errors.
+func decodeConfigFile(path string, out interface{}) (*yaml.Node, configErrors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := expandEnv(&root); err != nil {
+		return nil, nil, err
+	}
+	if root.Kind == 0 {
+		return &root, nil, nil
+	}
+
+	problems := unknownFields(data, out)
+	if err := root.Decode(out); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		problems = append(problems, typeErrors(typeErr)...)
+	}
+	return &root, problems, nil
+}
+
+// unknownFields returns the keys in data that are not fields of out. Only
+// yaml.Decoder can reject unknown keys, so data is decoded once more into a
+// scratch value, before environment variables are expanded. Keys are never
+// expanded, and the other errors of this decoding are ignored.
+func unknownFields(data []byte, out interface{}) configErrors {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	scratch := reflect.New(reflect.TypeOf(out).Elem()).Interface()
+	var typeErr *yaml.TypeError
+	if err := dec.Decode(scratch); !errors.As(err, &typeErr) {
+		return nil
+	}
+
+	var problems configErrors
+	for _, problem := range typeErrors(typeErr) {
+		if strings.HasPrefix(problem.Message, "field ") && strings.Contains(problem.Message, " not found in type ") {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// typeErrors converts the "line N: message" errors of a yaml.TypeError.
+func typeErrors(err *yaml.TypeError) configErrors {
+	errs := make(configErrors, 0, len(err.Errors))
+	for _, message := range err.Errors {
+		var line int
+		if prefix, rest, ok := strings.Cut(message, ": "); ok {
+			if _, scanErr := fmt.Sscanf(prefix, "line %d", &line); scanErr == nil {
+				message = rest
+			}
+		}
+		errs = append(errs, configError{Line: line, Message: message})
+	}
+	return errs
+}
+
+// loadIncludes appends the checks of every fragment matched by cfg.Include.
+// Each check records the file it came from. The decoding problems of the
+// fragments are returned with their file.
+func loadIncludes(cfg *Config, configPath string, positions *configPositions) (configErrors, error) {
+	files, err := includedFiles(configPath, cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems configErrors
+	for _, file := range files {
+		var fragment ConfigFragment
+		root, fragmentProblems, err := decodeConfigFile(file, &fragment)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", file, err)
+		}
+		for _, problem := range fragmentProblems {
+			problem.File = file
+			problems = append(problems, problem)
+		}
+
+		for i := range fragment.Checks {
+			fragment.Checks[i].Source = file
+		}
+		cfg.Checks = append(cfg.Checks, fragment.Checks...)
+		positions.checks = append(positions.checks, newConfigPositions(root, file).checks...)
+	}
+	return problems, nil
+}
+
+// includedFiles expands the include patterns of the config at configPath.
+// Relative patterns are resolved against the config file's directory. The
+// matches are sorted per pattern; the config file itself and files matched
+// more than once are skipped. A pattern without matches is not an error.
+func includedFiles(configPath string, patterns []string) ([]string, error) {
+	seen := map[string]bool{filepath.Clean(configPath): true}
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(configPath), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// envPattern matches ${VAR} and ${VAR:-default} references, and the escaped
+// form $${ that stands for a literal ${.
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in the values of the
+// parsed config file. Values are expanded after parsing, so whatever a
+// variable contains, such as # or ": ", is never read as YAML. Keys and
+// comments are left untouched. ${VAR:-default} falls back to default when
+// VAR is unset or empty; an unset ${VAR} without a default is an error.
+func expandEnv(root *yaml.Node) error {
+	var errs configErrors
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			value := expandEnvValue(node.Value, node.Line, &errs)
+			if value != node.Value && node.Style == 0 {
+				// Resolve the type of an expanded plain value, such as a
+				// port, from its new content, but never turn it into null.
+				if tag := (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag(); tag != "!!null" {
+					node.Tag = tag
+				}
+			}
+			node.Value = value
+		case yaml.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 {
+				walk(node.Content[i])
+			}
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// expandEnvValue expands the references in value, found on line. Unset
+// variables are added to errs.
+func expandEnvValue(value string, line int, errs *configErrors) string {
+	return envPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		match := envPattern.FindStringSubmatch(ref)
+		value, ok := os.LookupEnv(match[1])
+		if match[2] != "" {
+			if value == "" {
+				return match[3]
+			}
+			return value
+		}
+		if !ok {
+			*errs = append(*errs, configError{Line: line, Message: fmt.Sprintf("environment variable %s is not set", match[1])})
+		}
+		return value
+	})
+}
+
+// resolveSecrets loads *_file secret fields. Relative paths are resolved
+// against baseDir, the directory of the config file.
+func resolveSecrets(cfg *Config, baseDir string) error {
+	auth := &cfg.Server.Auth
+	if err := resolveSecretFile(baseDir, "password", &auth.Password, auth.PasswordFile); err != nil {
+		return fmt.Errorf("server.auth: %w", err)
+	}
+
+	for _, notifierCfg := range cfg.Notifications.Notifiers {
+		if smtpCfg := notifierCfg.SMTP; smtpCfg != nil {
+			if err := resolveSecretFile(baseDir, "password", &smtpCfg.Password, smtpCfg.PasswordFile); err != nil {
+				return fmt.Errorf("notifications: notifier %q: smtp: %w", notifierCfg.Name, err)
+			}
+		}
+		if events := notifierCfg.PagerDuty; events != nil {
+			if err := resolveSecretFile(baseDir, "routing_key", &events.RoutingKey, events.RoutingKeyFile); err != nil {
+				return fmt.Errorf("notifications: notifier %q: pagerduty: %w", notifierCfg.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecretFile sets *value, the secret field named field, from file if
+// one is given. Setting both the field and its file is an error.
+func resolveSecretFile(baseDir, field string, value *string, file string) error {
+	if file == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %s_file are mutually exclusive", field, field)
+	}
+	secret, err := readSecretFile(baseDir, file)
+	if err != nil {
+		return fmt.Errorf("%s_file: %w", field, err)
+	}
+	*value = secret
+	return nil
+}
+
+// resolveConfigPath resolves a relative path from the config against
+// baseDir, the directory of the file it was defined in. Empty and absolute
+// paths are returned unchanged.
+func resolveConfigPath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// readSecretFile returns the contents of path with trailing newlines trimmed.
+func readSecretFile(baseDir, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// applyCheckDefaults fills in check fields that can be derived from others,
+// such as the host and port of an HTTP check from its URL or the standard
+// port of a DNS server.
+func applyCheckDefaults(portCheck *PortCheck) {
+	if portCheck.Type == checkTypeDNS && portCheck.Port == 0 {
+		portCheck.Port = defaultDNSPort
+	}
+	if portCheck.Type != checkTypeHTTP || portCheck.HTTP == nil {
+		return
+	}
+
+	host, port, err := httpURLTarget(portCheck.HTTP.URL)
+	if err != nil {
+		return
+	}
+	if portCheck.Host == "" {
+		portCheck.Host = host
+	}
+	if portCheck.Port == 0 {
+		portCheck.Port = port
+	}
+}
+
+// httpURLTarget returns the host and port an HTTP check's requests go to.
+// Without an explicit port the URL's scheme determines it.
+func httpURLTarget(rawURL string) (string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", 0, err
+	}
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		return u.Hostname(), port, nil
+	}
+	if u.Scheme == "https" {
+		return u.Hostname(), 443, nil
+	}
+	return u.Hostname(), 80, nil
+}
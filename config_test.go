@@ -3,8 +3,12 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -255,3 +259,527 @@ checks:
 		t.Errorf("Check[2].Timeout = %v, want 500ms", cfg.Checks[2].Timeout)
 	}
 }
+
+func TestLoadConfigConcurrencyAndDeadline(t *testing.T) {
+	tests := []struct {
+		name            string
+		configData      string
+		wantConcurrency int
+		wantDeadline    time.Duration
+	}{
+		{
+			name: "defaults",
+			configData: `
+checks:
+  - host: "localhost"
+    port: 8080
+    name: "Test Service"
+`,
+			wantConcurrency: defaultMaxConcurrency,
+			wantDeadline:    0,
+		},
+		{
+			name: "custom values",
+			configData: `
+server:
+  max_concurrency: 25
+  deadline: 3s
+checks:
+  - host: "localhost"
+    port: 8080
+    name: "Test Service"
+`,
+			wantConcurrency: 25,
+			wantDeadline:    3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.configData), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			cfg, err := loadConfig(configPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if cfg.Server.MaxConcurrency != tt.wantConcurrency {
+				t.Errorf("MaxConcurrency = %d, want %d", cfg.Server.MaxConcurrency, tt.wantConcurrency)
+			}
+			if cfg.Server.Deadline != tt.wantDeadline {
+				t.Errorf("Deadline = %v, want %v", cfg.Server.Deadline, tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHTTPCheck(t *testing.T) {
+	configData := `
+checks:
+  - name: "Webmail"
+    type: http
+    http:
+      url: "https://mail.example.com/login"
+      method: HEAD
+      headers:
+        User-Agent: "PortGuard"
+      expected_status: [200, 302]
+      body_contains: "Sign in"
+      follow_redirects: true
+  - name: "API"
+    type: http
+    http:
+      url: "http://api.example.com:8080/healthz"
+  - name: "Status"
+    host: "status.example.com"
+    type: http
+    http:
+      url: "https://STATUS.example.com/"
+`
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	webmail := cfg.Checks[0]
+	if webmail.Type != checkTypeHTTP || webmail.HTTP == nil {
+		t.Fatalf("Check[0] = %+v, want http check", webmail)
+	}
+	if webmail.HTTP.Method != "HEAD" || !webmail.HTTP.FollowRedirects {
+		t.Errorf("Check[0].HTTP = %+v, want HEAD with redirects", webmail.HTTP)
+	}
+	if len(webmail.HTTP.ExpectedStatus) != 2 || webmail.HTTP.Headers["User-Agent"] != "PortGuard" {
+		t.Errorf("Check[0].HTTP = %+v, want expected statuses and headers", webmail.HTTP)
+	}
+
+	// Host and port are derived from the URL
+	if webmail.Host != "mail.example.com" || webmail.Port != 443 {
+		t.Errorf("Check[0] host:port = %s:%d, want mail.example.com:443", webmail.Host, webmail.Port)
+	}
+	if api := cfg.Checks[1]; api.Host != "api.example.com" || api.Port != 8080 {
+		t.Errorf("Check[1] host:port = %s:%d, want api.example.com:8080", api.Host, api.Port)
+	}
+	// An explicit host still takes the port from the URL
+	if status := cfg.Checks[2]; status.Host != "status.example.com" || status.Port != 443 {
+		t.Errorf("Check[2] host:port = %s:%d, want status.example.com:443", status.Host, status.Port)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("PORTGUARD_TEST_HOST", "db.internal")
+	t.Setenv("PORTGUARD_TEST_EMPTY", "")
+	t.Setenv("PORTGUARD_TEST_HASH", "abc #def")
+	t.Setenv("PORTGUARD_TEST_COLON", "user: admin")
+	t.Setenv("PORTGUARD_TEST_ANCHOR", "*secret")
+	t.Setenv("PORTGUARD_TEST_QUOTES", `it's "quoted" \n`)
+	t.Setenv("PORTGUARD_TEST_NULL", "null")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "set variable",
+			input: "host: ${PORTGUARD_TEST_HOST}\n",
+			want:  map[string]string{"host": "db.internal"},
+		},
+		{
+			name:  "default for unset variable",
+			input: "port: ${PORTGUARD_TEST_UNSET:-5432}\n",
+			want:  map[string]string{"port": "5432"},
+		},
+		{
+			name:  "default for empty variable",
+			input: "name: ${PORTGUARD_TEST_EMPTY:-fallback}\n",
+			want:  map[string]string{"name": "fallback"},
+		},
+		{
+			name:  "set but empty without default",
+			input: "name: \"${PORTGUARD_TEST_EMPTY}\"\n",
+			want:  map[string]string{"name": ""},
+		},
+		{
+			name:  "escaped reference",
+			input: "password: \"pa$${PORTGUARD_TEST_HOST}\"\n",
+			want:  map[string]string{"password": "pa${PORTGUARD_TEST_HOST}"},
+		},
+		{
+			name:  "comments are not expanded",
+			input: "# host: ${PORTGUARD_TEST_UNSET}\nport: 1 # ${PORTGUARD_TEST_UNSET}\n",
+			want:  map[string]string{"port": "1"},
+		},
+		{
+			name:  "value with comment character",
+			input: "password: ${PORTGUARD_TEST_HASH}\n",
+			want:  map[string]string{"password": "abc #def"},
+		},
+		{
+			name:  "value with colon",
+			input: "password: ${PORTGUARD_TEST_COLON}\n",
+			want:  map[string]string{"password": "user: admin"},
+		},
+		{
+			name:  "value with leading alias character",
+			input: "password: ${PORTGUARD_TEST_ANCHOR}\n",
+			want:  map[string]string{"password": "*secret"},
+		},
+		{
+			name:  "value with quotes and backslash",
+			input: "plain: ${PORTGUARD_TEST_QUOTES}\nquoted: \"${PORTGUARD_TEST_QUOTES}\"\n",
+			want:  map[string]string{"plain": `it's "quoted" \n`, "quoted": `it's "quoted" \n`},
+		},
+		{
+			name:  "value that looks like null",
+			input: "password: ${PORTGUARD_TEST_NULL}\n",
+			want:  map[string]string{"password": "null"},
+		},
+		{
+			name:    "unset variable",
+			input:   "port: 1\nhost: ${PORTGUARD_TEST_UNSET}\n",
+			wantErr: "line 2: environment variable PORTGUARD_TEST_UNSET is not set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &root); err != nil {
+				t.Fatalf("Failed to parse input: %v", err)
+			}
+			err := expandEnv(&root)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got map[string]string
+			if err := root.Decode(&got); err != nil {
+				t.Fatalf("Failed to decode expanded config: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigExpandsEnvValues(t *testing.T) {
+	t.Setenv("PORTGUARD_TEST_PASSWORD", "abc #def")
+	t.Setenv("PORTGUARD_TEST_PORT", "2222")
+
+	configData := `
+server:
+  auth:
+    enabled: true
+    username: "admin"
+    password: ${PORTGUARD_TEST_PASSWORD}
+checks:
+  - host: "localhost"
+    port: ${PORTGUARD_TEST_PORT}
+    name: "SSH"
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Server.Auth.Password != "abc #def" {
+		t.Errorf("Password = %q, want %q", cfg.Server.Auth.Password, "abc #def")
+	}
+	if cfg.Checks[0].Port != 2222 {
+		t.Errorf("Port = %d, want 2222", cfg.Checks[0].Port)
+	}
+}
+
+func TestLoadConfigPasswordFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "password"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to create password file: %v", err)
+	}
+	t.Setenv("PORTGUARD_TEST_USER", "admin")
+
+	configData := `
+server:
+  auth:
+    enabled: true
+    username: "${PORTGUARD_TEST_USER}"
+    password_file: password
+checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+`
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Server.Auth.Username != "admin" {
+		t.Errorf("Username = %q, want %q", cfg.Server.Auth.Username, "admin")
+	}
+	if cfg.Server.Auth.Password != "s3cret" {
+		t.Errorf("Password = %q, want %q", cfg.Server.Auth.Password, "s3cret")
+	}
+
+	if err := os.Remove(filepath.Join(tmpDir, "password")); err != nil {
+		t.Fatalf("Failed to remove password file: %v", err)
+	}
+	if _, err := loadConfig(configPath); err == nil || !strings.Contains(err.Error(), "password_file") {
+		t.Errorf("Error = %v, want a password_file error", err)
+	}
+}
+
+func TestLoadConfigNotifierSecretFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "secrets"), 0700); err != nil {
+		t.Fatalf("Failed to create secrets directory: %v", err)
+	}
+	for name, secret := range map[string]string{"smtp": "mail-s3cret\n", "pagerduty": "R0UT1NGK3Y\n"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, "secrets", name), []byte(secret), 0600); err != nil {
+			t.Fatalf("Failed to create secret file: %v", err)
+		}
+	}
+
+	configData := `
+checks:
+  - host: "localhost"
+    port: 25
+    name: "SMTP"
+notifications:
+  notifiers:
+    - name: "mail"
+      type: smtp
+      smtp:
+        host: "mail.example.com"
+        username: "portguard"
+        password_file: secrets/smtp
+        from: "portguard@example.com"
+        to: ["ops@example.com"]
+    - name: "pager"
+      type: pagerduty
+      pagerduty:
+        routing_key_file: secrets/pagerduty
+`
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := cfg.Notifications.Notifiers[0].SMTP.Password; got != "mail-s3cret" {
+		t.Errorf("SMTP password = %q, want %q", got, "mail-s3cret")
+	}
+	if got := cfg.Notifications.Notifiers[1].PagerDuty.RoutingKey; got != "R0UT1NGK3Y" {
+		t.Errorf("Routing key = %q, want %q", got, "R0UT1NGK3Y")
+	}
+
+	both := strings.Replace(configData, "password_file: secrets/smtp", "password_file: secrets/smtp\n        password: inline", 1)
+	if err := os.WriteFile(configPath, []byte(both), 0644); err != nil {
+		t.Fatalf("Failed to update test config file: %v", err)
+	}
+	if _, err := loadConfig(configPath); err == nil || !strings.Contains(err.Error(), `notifier "mail": smtp: password and password_file are mutually exclusive`) {
+		t.Errorf("Error = %v, want password and password_file to be mutually exclusive", err)
+	}
+}
+
+func TestLoadConfigRelativePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "conf.d"), 0755); err != nil {
+		t.Fatalf("Failed to create include directory: %v", err)
+	}
+
+	files := map[string]string{
+		"config.yaml": `
+include:
+  - conf.d/*.yaml
+checks:
+  - host: "mail.example.com"
+    port: 465
+    name: "SMTPS"
+    type: tls
+    tls:
+      ca_file: certs/internal-ca.pem
+notifications:
+  dead_letter_file: dead-letter.jsonl
+  notifiers:
+    - name: "mail"
+      type: smtp
+      smtp:
+        host: "smtp.example.com"
+        ca_file: certs/smtp-ca.pem
+        from: "portguard@example.com"
+        to: ["ops@example.com"]
+`,
+		"conf.d/imap.yaml": `
+checks:
+  - host: "mail.example.com"
+    port: 993
+    name: "IMAPS"
+    type: tls
+    tls:
+      ca_file: imap-ca.pem
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg, err := loadConfig(filepath.Join(tmpDir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "tls ca_file", got: cfg.Checks[0].TLS.CAFile, want: filepath.Join(tmpDir, "certs", "internal-ca.pem")},
+		{name: "included tls ca_file", got: cfg.Checks[1].TLS.CAFile, want: filepath.Join(tmpDir, "conf.d", "imap-ca.pem")},
+		{name: "smtp ca_file", got: cfg.Notifications.Notifiers[0].SMTP.CAFile, want: filepath.Join(tmpDir, "certs", "smtp-ca.pem")},
+		{name: "dead_letter_file", got: cfg.Notifications.DeadLetterFile, want: filepath.Join(tmpDir, "dead-letter.jsonl")},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigIncludes(t *testing.T) {
+	tmpDir := t.TempDir()
+	confDir := filepath.Join(tmpDir, "conf.d")
+	if err := os.Mkdir(confDir, 0755); err != nil {
+		t.Fatalf("Failed to create include directory: %v", err)
+	}
+
+	files := map[string]string{
+		"config.yaml": `
+include:
+  - conf.d/*.yaml
+checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+`,
+		"conf.d/b-web.yaml": `
+checks:
+  - host: "localhost"
+    port: 80
+    name: "Web"
+`,
+		"conf.d/a-db.yaml": `
+checks:
+  - host: "localhost"
+    port: 5432
+    name: "Database"
+  - host: "localhost"
+    port: 6379
+    name: "Cache"
+`,
+		"conf.d/ignored.yml": "checks: [{host: localhost, port: 1, name: Ignored}]\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []struct {
+		name   string
+		source string
+	}{
+		{"SSH", configPath},
+		{"Database", filepath.Join(confDir, "a-db.yaml")},
+		{"Cache", filepath.Join(confDir, "a-db.yaml")},
+		{"Web", filepath.Join(confDir, "b-web.yaml")},
+	}
+	if len(cfg.Checks) != len(want) {
+		t.Fatalf("Number of checks = %d, want %d", len(cfg.Checks), len(want))
+	}
+	for i, w := range want {
+		if cfg.Checks[i].Name != w.name || cfg.Checks[i].Source != w.source {
+			t.Errorf("Check %d = %q from %s, want %q from %s", i, cfg.Checks[i].Name, cfg.Checks[i].Source, w.name, w.source)
+		}
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		wantErr  string
+	}{
+		{
+			name:     "duplicate name across files",
+			fragment: "checks:\n  - host: \"localhost\"\n    port: 2222\n    name: \"SSH\"\n",
+			wantErr:  `team.yaml: line 4: check "SSH": name: duplicate name, first defined in `,
+		},
+		{
+			name:     "server settings in fragment",
+			fragment: "server:\n  port: \"9999\"\n",
+			wantErr:  "field server not found",
+		},
+		{
+			name:     "invalid check in fragment",
+			fragment: "checks:\n  - host: \"localhost\"\n    port: 0\n    name: \"Broken\"\n",
+			wantErr:  `team.yaml: line 3: check "Broken": port: 0 is out of range`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+			configData := "include: [\"team.yaml\"]\nchecks:\n  - host: \"localhost\"\n    port: 22\n    name: \"SSH\"\n"
+			if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tmpDir, "team.yaml"), []byte(tt.fragment), 0644); err != nil {
+				t.Fatalf("Failed to create fragment: %v", err)
+			}
+
+			_, err := loadConfig(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 )
 
 const headerContentType = "Content-Type"
@@ -49,22 +52,133 @@ func basicAuthMiddleware(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func healthHandler(cfg *Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
-		status := performHealthCheck(cfg)
+// healthHandler reports the health of all checks.
+// When background checking is enabled it serves cached results from store,
+// unless the request asks for a live run with ?fresh=1. Live results are
+// recorded in store when one is given.
+func healthHandler(cfg *Config, store *resultStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveHealth(w, r, cfg, store, cfg.Checks)
+	}
+}
+
+// groupHealthHandler reports the health of the checks in the group named by
+// the {name} path segment, with the same status codes as /health.
+func groupHealthHandler(cfg *Config, store *resultStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		checks := filterChecks(cfg.Checks, func(portCheck PortCheck) bool {
+			return slices.Contains(portCheck.Groups, name)
+		})
+		if len(checks) == 0 {
+			http.Error(w, fmt.Sprintf("unknown group %q", name), http.StatusNotFound)
+			return
+		}
+		serveHealth(w, r, cfg, store, checks)
+	}
+}
+
+// serveHealth writes the health of checks, a subset of cfg.Checks.
+// With ?tag= parameters only checks carrying one of the tags are evaluated.
+func serveHealth(w http.ResponseWriter, r *http.Request, cfg *Config, store *resultStore, checks []PortCheck) {
+	if tags := r.URL.Query()["tag"]; len(tags) > 0 {
+		checks = filterChecks(checks, func(portCheck PortCheck) bool {
+			return slices.ContainsFunc(tags, func(tag string) bool {
+				return slices.Contains(portCheck.Tags, tag)
+			})
+		})
+		if len(checks) == 0 {
+			http.Error(w, fmt.Sprintf("no checks with tag %q", tags), http.StatusNotFound)
+			return
+		}
+	}
+
+	status := evaluateHealth(r, cfg, store, checks)
+	if cfg.generation > 0 {
+		status.ConfigGeneration = cfg.generation
+		status.ConfigLoadedAt = cfg.loadedAt.Format(time.RFC3339)
+	}
+
+	w.Header().Set(headerContentType, "application/json")
+
+	w.WriteHeader(healthStatusCode(cfg, status.Status))
+
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// checkHealthHandler reports the result of the single check named by the
+// {name} path segment: 200 if it is healthy, 503 if it failed and 404 for an
+// unknown name. A degraded result returns server.degraded_status_code. The
+// check's severity does not affect the status code.
+func checkHealthHandler(cfg *Config, store *resultStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		i := slices.IndexFunc(cfg.Checks, func(portCheck PortCheck) bool {
+			return portCheck.Name == name
+		})
+		if i < 0 {
+			http.Error(w, fmt.Sprintf("unknown check %q", name), http.StatusNotFound)
+			return
+		}
+
+		result := evaluateHealth(r, cfg, store, cfg.Checks[i:i+1]).Checks[0]
 
 		w.Header().Set(headerContentType, "application/json")
+		w.WriteHeader(healthStatusCode(cfg, result.Status))
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+// evaluateHealth returns the health of checks, a subset of cfg.Checks, from
+// cached results or from a live run as requested by r.
+func evaluateHealth(r *http.Request, cfg *Config, store *resultStore, checks []PortCheck) HealthStatus {
+	view := *cfg
+	view.Checks = checks
+
+	if store != nil && cfg.Server.CheckInterval > 0 && !isFreshRequest(r) {
+		return cachedHealthCheck(&view, store)
+	}
 
-		if status.Status == "healthy" {
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
+	status := performHealthCheck(&view)
+	if store != nil {
+		status = buildHealthStatus(store.update(checks, status.Checks))
+	}
+	return status
+}
+
+// filterChecks returns the checks for which keep reports true.
+func filterChecks(checks []PortCheck, keep func(PortCheck) bool) []PortCheck {
+	var filtered []PortCheck
+	for _, portCheck := range checks {
+		if keep(portCheck) {
+			filtered = append(filtered, portCheck)
 		}
+	}
+	return filtered
+}
 
-		_ = json.NewEncoder(w).Encode(status)
+// healthStatusCode maps an overall or check status to the response code.
+// Only unhealthy results, i.e. failed critical checks, return 503.
+func healthStatusCode(cfg *Config, status string) int {
+	switch status {
+	case "healthy":
+		return http.StatusOK
+	case "degraded":
+		if cfg.Server.DegradedStatusCode != 0 {
+			return cfg.Server.DegradedStatusCode
+		}
+		return http.StatusOK
+	default:
+		return http.StatusServiceUnavailable
 	}
 }
 
+// isFreshRequest reports whether the client asked to bypass cached results.
+func isFreshRequest(r *http.Request) bool {
+	fresh, err := strconv.ParseBool(r.URL.Query().Get("fresh"))
+	return err == nil && fresh
+}
+
 func liveHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set(headerContentType, "text/plain")
 	w.WriteHeader(http.StatusOK)
@@ -102,7 +216,10 @@ func rootHandler(cfg *Config) http.HandlerFunc {
         <h2>Available Endpoints:</h2>
         <ul>
             <li><a href="/health"><code>/health</code></a> - Detailed health status with all port checks (JSON)</li>
+            <li><code>/health/group/{name}</code> - Health status of the checks in one group (JSON)</li>
+            <li><code>/health/check/{name}</code> - Result of a single check (JSON)</li>
             <li><a href="/live"><code>/live</code></a> - Simple liveness check (returns OK)</li>
+            <li><a href="/metrics"><code>/metrics</code></a> - Prometheus metrics from the latest check results</li>
         </ul>
         <h2>Configuration:</h2>
         <p>Monitoring <strong>%d ports</strong></p>
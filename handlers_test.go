@@ -84,7 +84,7 @@ func TestHealthHandler(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/health", nil)
 			rec := httptest.NewRecorder()
 
-			handler := healthHandler(tt.config)
+			handler := healthHandler(tt.config, nil)
 			handler(rec, req)
 
 			if rec.Code != tt.wantStatusCode {
@@ -173,7 +173,7 @@ func TestHealthHandlerMultipleChecks(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	rec := httptest.NewRecorder()
 
-	handler := healthHandler(cfg)
+	handler := healthHandler(cfg, nil)
 	handler(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -400,7 +400,7 @@ func TestHandlersHTTPMethods(t *testing.T) {
 			req := httptest.NewRequest(method, "/health", nil)
 			rec := httptest.NewRecorder()
 
-			handler := healthHandler(cfg)
+			handler := healthHandler(cfg, nil)
 			handler(rec, req)
 
 			// Handler should accept all methods (it doesn't check method)
@@ -437,3 +437,281 @@ func TestHandlersHTTPMethods(t *testing.T) {
 		}
 	})
 }
+
+func TestHealthHandlerServesCachedResults(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	var testPort int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &testPort)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:       2 * time.Second,
+			CheckInterval: time.Hour,
+		},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: testPort, Name: "Test Service"},
+		},
+	}
+
+	// Seed the cache with a stale failure although the port is listening
+	store := newResultStore()
+	store.set(cfg.Checks[0], PortCheckResult{
+		Name:      "Test Service",
+		Host:      "127.0.0.1",
+		Port:      testPort,
+		Status:    "unhealthy",
+		Error:     "stale",
+		CheckedAt: "2025-01-01T00:00:00Z",
+	})
+
+	handler := healthHandler(cfg, store)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Cached: status code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	var status HealthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.Checks[0].CheckedAt != "2025-01-01T00:00:00Z" {
+		t.Errorf("CheckedAt = %q, want cached timestamp", status.Checks[0].CheckedAt)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health?fresh=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Fresh: status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// The live run refreshes the cache
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("After fresh: status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHealthHandlerDegraded(t *testing.T) {
+	tests := []struct {
+		name               string
+		degradedStatusCode int
+		severity           string
+		wantCode           int
+		wantStatus         string
+	}{
+		{
+			name:       "critical failure",
+			severity:   severityCritical,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unhealthy",
+		},
+		{
+			name:       "warning failure with default code",
+			severity:   severityWarning,
+			wantCode:   http.StatusOK,
+			wantStatus: "degraded",
+		},
+		{
+			name:               "warning failure with configured code",
+			degradedStatusCode: http.StatusMultiStatus,
+			severity:           severityWarning,
+			wantCode:           http.StatusMultiStatus,
+			wantStatus:         "degraded",
+		},
+		{
+			name:       "info failure",
+			severity:   severityInfo,
+			wantCode:   http.StatusOK,
+			wantStatus: "healthy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{
+					Timeout:            500 * time.Millisecond,
+					DegradedStatusCode: tt.degradedStatusCode,
+				},
+				Checks: []PortCheck{
+					{Host: "127.0.0.1", Port: 1, Name: "Optional", Severity: tt.severity},
+				},
+			}
+
+			rec := httptest.NewRecorder()
+			healthHandler(cfg, nil)(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("Status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			var status HealthStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if status.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", status.Status, tt.wantStatus)
+			}
+			if status.Checks[0].Severity != tt.severity {
+				t.Errorf("Check severity = %q, want %q", status.Checks[0].Severity, tt.severity)
+			}
+		})
+	}
+}
+
+func TestHealthGroupsAndTags(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	cfg := &Config{
+		Server: ServerConfig{Timeout: 500 * time.Millisecond},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: openPort, Name: "SMTP", Groups: []string{"mail"}, Tags: []string{"smtp"}},
+			{Host: "127.0.0.1", Port: openPort, Name: "IMAP", Groups: []string{"mail"}, Tags: []string{"imap"}},
+			{Host: "127.0.0.1", Port: 1, Name: "HTTPS", Groups: []string{"webmail"}},
+		},
+	}
+	mux := newServeMux(cfg, nil)
+
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantChecks []string
+	}{
+		{"/health/group/mail", http.StatusOK, []string{"SMTP", "IMAP"}},
+		{"/health/group/webmail", http.StatusServiceUnavailable, []string{"HTTPS"}},
+		{"/health/group/unknown", http.StatusNotFound, nil},
+		{"/health?tag=smtp", http.StatusOK, []string{"SMTP"}},
+		{"/health?tag=imap&tag=smtp", http.StatusOK, []string{"SMTP", "IMAP"}},
+		{"/health/group/mail?tag=imap", http.StatusOK, []string{"IMAP"}},
+		{"/health?tag=unknown", http.StatusNotFound, nil},
+		{"/health", http.StatusServiceUnavailable, []string{"SMTP", "IMAP", "HTTPS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantChecks == nil {
+				return
+			}
+
+			var status HealthStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var names []string
+			for _, result := range status.Checks {
+				names = append(names, result.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantChecks, ",") {
+				t.Errorf("Checks = %v, want %v", names, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestCheckHealthHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout: 500 * time.Millisecond,
+			Auth:    AuthConfig{Enabled: true, Username: "admin", Password: "secret"},
+		},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: openPort, Name: "SMTP Submission"},
+			{Host: "127.0.0.1", Port: 1, Name: "IMAP", Severity: severityInfo},
+		},
+	}
+	mux := newServeMux(cfg, nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/check/IMAP", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Without credentials: status code = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantStatus string
+	}{
+		{"/health/check/SMTP%20Submission", http.StatusOK, "healthy"},
+		{"/health/check/IMAP", http.StatusServiceUnavailable, "unhealthy"},
+		{"/health/check/POP3", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.SetBasicAuth("admin", "secret")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+
+			var result PortCheckResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", result.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the check latency histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// checkMetrics accumulates per-check counters and latency histograms.
+// It is guarded by the mutex of the resultStore that owns it.
+type checkMetrics struct {
+	results   map[string]map[string]uint64
+	latencies map[string]*latencyHistogram
+}
+
+type latencyHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newCheckMetrics() *checkMetrics {
+	return &checkMetrics{
+		results:   make(map[string]map[string]uint64),
+		latencies: make(map[string]*latencyHistogram),
+	}
+}
+
+// observe counts result and records its latency for the check identified by key.
+func (m *checkMetrics) observe(key string, result PortCheckResult) {
+	if m.results[key] == nil {
+		m.results[key] = make(map[string]uint64)
+	}
+	m.results[key][result.Status]++
+
+	if result.LatencyMS <= 0 {
+		return
+	}
+	histogram := m.latencies[key]
+	if histogram == nil {
+		histogram = &latencyHistogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latencies[key] = histogram
+	}
+	seconds := result.LatencyMS / 1000
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			histogram.buckets[i]++
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+// metricsHandler exposes the stored results in the Prometheus text format.
+// It never runs checks itself, so scrapes do not add load to the monitored services.
+func metricsHandler(cfg *Config, store *resultStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(headerContentType, "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		store.writeMetrics(w, cfg.Checks)
+	}
+}
+
+// writeMetrics renders the metrics of checks in the Prometheus text format.
+func (s *resultStore) writeMetrics(w io.Writer, checks []PortCheck) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, _ = fmt.Fprintln(w, "# HELP portguard_build_info PortGuard build information.")
+	_, _ = fmt.Fprintln(w, "# TYPE portguard_build_info gauge")
+	_, _ = fmt.Fprintf(w, "portguard_build_info{version=\"%s\"} 1\n", escapeLabelValue(appVersion))
+
+	_, _ = fmt.Fprintln(w, "# HELP portguard_check_up Whether the last check succeeded (1), even if degraded, or failed (0).")
+	_, _ = fmt.Fprintln(w, "# TYPE portguard_check_up gauge")
+	for _, portCheck := range checks {
+		result, ok := s.results[checkKey(portCheck)]
+		if !ok {
+			continue
+		}
+		up := 0
+		if result.Status == "healthy" || result.Status == "degraded" {
+			up = 1
+		}
+		_, _ = fmt.Fprintf(w, "portguard_check_up{%s} %d\n", checkLabels(portCheck), up)
+	}
+
+	_, _ = fmt.Fprintln(w, "# HELP portguard_checks_total Number of executed checks by result.")
+	_, _ = fmt.Fprintln(w, "# TYPE portguard_checks_total counter")
+	for _, portCheck := range checks {
+		counts := s.metrics.results[checkKey(portCheck)]
+		for _, status := range sortedKeys(counts) {
+			_, _ = fmt.Fprintf(w, "portguard_checks_total{%s,result=\"%s\"} %d\n",
+				checkLabels(portCheck), escapeLabelValue(status), counts[status])
+		}
+	}
+
+	_, _ = fmt.Fprintln(w, "# HELP portguard_check_latency_seconds Duration of checks in seconds.")
+	_, _ = fmt.Fprintln(w, "# TYPE portguard_check_latency_seconds histogram")
+	for _, portCheck := range checks {
+		histogram := s.metrics.latencies[checkKey(portCheck)]
+		if histogram == nil {
+			continue
+		}
+		labels := checkLabels(portCheck)
+		for i, bound := range latencyBuckets {
+			_, _ = fmt.Fprintf(w, "portguard_check_latency_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), histogram.buckets[i])
+		}
+		_, _ = fmt.Fprintf(w, "portguard_check_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, histogram.count)
+		_, _ = fmt.Fprintf(w, "portguard_check_latency_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+		_, _ = fmt.Fprintf(w, "portguard_check_latency_seconds_count{%s} %d\n", labels, histogram.count)
+	}
+}
+
+// checkLabels returns the name, host and port labels of portCheck.
+func checkLabels(portCheck PortCheck) string {
+	return fmt.Sprintf("name=\"%s\",host=\"%s\",port=\"%d\"",
+		escapeLabelValue(portCheck.Name), escapeLabelValue(portCheck.Host), portCheck.Port)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	cfg := &Config{
+		Checks: []PortCheck{
+			{Host: "10.0.0.2", Port: 25, Name: "SMTP"},
+			{Host: "10.0.0.2", Port: 143, Name: `IMAP "primary"`},
+			{Host: "10.0.0.2", Port: 4190, Name: "ManageSieve"},
+		},
+	}
+
+	store := newResultStore()
+	store.set(cfg.Checks[0], PortCheckResult{Status: "healthy", LatencyMS: 3})
+	store.set(cfg.Checks[0], PortCheckResult{Status: "unhealthy", LatencyMS: 2000})
+	store.set(cfg.Checks[0], PortCheckResult{Status: "healthy", LatencyMS: 40})
+	store.set(cfg.Checks[1], PortCheckResult{Status: "unhealthy", Error: "deadline exceeded"})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	metricsHandler(cfg, store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want Prometheus text format", contentType)
+	}
+
+	body := rec.Body.String()
+	smtp := `name="SMTP",host="10.0.0.2",port="25"`
+	imap := `name="IMAP \"primary\"",host="10.0.0.2",port="143"`
+
+	expected := []string{
+		`portguard_build_info{version="` + appVersion + `"} 1`,
+		"# TYPE portguard_check_up gauge",
+		"portguard_check_up{" + smtp + "} 1",
+		"portguard_check_up{" + imap + "} 0",
+		"# TYPE portguard_checks_total counter",
+		"portguard_checks_total{" + smtp + `,result="healthy"} 2`,
+		"portguard_checks_total{" + smtp + `,result="unhealthy"} 1`,
+		"portguard_checks_total{" + imap + `,result="unhealthy"} 1`,
+		"# TYPE portguard_check_latency_seconds histogram",
+		"portguard_check_latency_seconds_bucket{" + smtp + `,le="0.005"} 1`,
+		"portguard_check_latency_seconds_bucket{" + smtp + `,le="0.05"} 2`,
+		"portguard_check_latency_seconds_bucket{" + smtp + `,le="2.5"} 3`,
+		"portguard_check_latency_seconds_bucket{" + smtp + `,le="+Inf"} 3`,
+		"portguard_check_latency_seconds_sum{" + smtp + "} 2.043",
+		"portguard_check_latency_seconds_count{" + smtp + "} 3",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Metrics missing line %q\n%s", line, body)
+		}
+	}
+
+	// Checks without results or latencies are omitted
+	if strings.Contains(body, `name="ManageSieve"`) {
+		t.Error("Check without results should not be exported")
+	}
+	if strings.Contains(body, "portguard_check_latency_seconds_count{"+imap) {
+		t.Error("Result without latency should not be observed in the histogram")
+	}
+}
+
+func TestMetricsHandlerDoesNotRunChecks(t *testing.T) {
+	cfg := &Config{
+		Checks: []PortCheck{{Host: "127.0.0.1", Port: 1, Name: "Closed"}},
+	}
+	store := newResultStore()
+
+	rec := httptest.NewRecorder()
+	metricsHandler(cfg, store)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if _, ok := store.get(cfg.Checks[0]); ok {
+		t.Error("Scraping metrics should not record check results")
+	}
+	if strings.Contains(rec.Body.String(), "portguard_check_up{") {
+		t.Error("No check_up series expected before any check ran")
+	}
+}
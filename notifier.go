@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	notifierTypeWebhook      = "webhook"
+	notifierTypeSlack        = "slack"
+	notifierTypeMattermost   = "mattermost"
+	notifierTypeTeams        = "teams"
+	notifierTypeSMTP         = "smtp"
+	notifierTypePagerDuty    = "pagerduty"
+	notifierTypeAlertmanager = "alertmanager"
+	notifierTypeExec         = "exec"
+
+	// defaultNotifyTimeout bounds a single delivery attempt.
+	defaultNotifyTimeout = 10 * time.Second
+	// defaultNotifyAttempts is how often a delivery is tried before it is
+	// written to the dead-letter log.
+	defaultNotifyAttempts = 3
+	// defaultNotifyBackoff is the wait before the first retry of a delivery.
+	defaultNotifyBackoff = time.Second
+	// notifyQueueSize limits the pending notifications per notifier.
+	notifyQueueSize = 100
+)
+
+// notifier delivers state changes to a single target.
+type notifier interface {
+	notify(ctx context.Context, change StateChange) error
+}
+
+// backgroundNotifier is a notifier with work of its own between changes.
+// start receives the checks that are already failing, as the changes from
+// "unknown" that reported them.
+type backgroundNotifier interface {
+	notifier
+	start(failing []StateChange)
+	stop()
+}
+
+// batchNotifier is a notifier that can deliver several changes at once,
+// which is used with a batch window.
+type batchNotifier interface {
+	notifier
+	notifyBatch(ctx context.Context, changes []StateChange) error
+}
+
+// concurrentNotifier is a notifier that can deliver the changes of different
+// checks in parallel, with up to concurrency deliveries at once.
+type concurrentNotifier interface {
+	notifier
+	concurrency() int
+}
+
+// newNotifier creates the notifier configured by cfg.
+func newNotifier(cfg NotifierConfig) (notifier, error) {
+	switch cfg.Type {
+	case notifierTypeWebhook:
+		if cfg.Webhook == nil {
+			return nil, errors.New("webhook notifier requires a webhook block")
+		}
+		return newWebhookNotifier(cfg.Webhook)
+	case notifierTypeSlack, notifierTypeMattermost:
+		chat := cfg.Slack
+		if cfg.Type == notifierTypeMattermost {
+			chat = cfg.Mattermost
+		}
+		if chat == nil {
+			return nil, fmt.Errorf("%s notifier requires a %s block", cfg.Type, cfg.Type)
+		}
+		return newSlackNotifier(chat), nil
+	case notifierTypeTeams:
+		if cfg.Teams == nil {
+			return nil, errors.New("teams notifier requires a teams block")
+		}
+		return newTeamsNotifier(cfg.Teams), nil
+	case notifierTypeSMTP:
+		if cfg.SMTP == nil {
+			return nil, errors.New("smtp notifier requires an smtp block")
+		}
+		return newSMTPNotifier(cfg.SMTP)
+	case notifierTypePagerDuty:
+		if cfg.PagerDuty == nil {
+			return nil, errors.New("pagerduty notifier requires a pagerduty block")
+		}
+		return newEventsNotifier(cfg.PagerDuty), nil
+	case notifierTypeAlertmanager:
+		if cfg.Alertmanager == nil {
+			return nil, errors.New("alertmanager notifier requires an alertmanager block")
+		}
+		return newAlertmanagerNotifier(cfg.Alertmanager), nil
+	case notifierTypeExec:
+		if cfg.Exec == nil {
+			return nil, errors.New("exec notifier requires an exec block")
+		}
+		return newExecNotifier(cfg.Name, cfg.Exec)
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+// newStateChange returns the change from previous to result, the stored
+// results of a check, and whether there is one to report. The first result
+// of a check is only reported when it is not healthy.
+func newStateChange(previous *PortCheckResult, result PortCheckResult) (StateChange, bool) {
+	oldStatus := "unknown"
+	if previous != nil {
+		oldStatus = previous.Status
+	}
+	if oldStatus == result.Status || (previous == nil && result.Status == "healthy") {
+		return StateChange{}, false
+	}
+
+	return StateChange{
+		Name:        result.Name,
+		Host:        result.Host,
+		Port:        result.Port,
+		Address:     net.JoinHostPort(result.Host, strconv.Itoa(result.Port)),
+		Description: result.Description,
+		Severity:    result.Severity,
+		Groups:      result.Groups,
+		Tags:        result.Tags,
+		OldStatus:   oldStatus,
+		NewStatus:   result.Status,
+		Error:       result.Error,
+		Warning:     result.Warning,
+		Timestamp:   result.LastStateChange,
+	}, true
+}
+
+// resolved reports whether change ends the failure of its check, because the
+// check recovered or a reload removed it.
+func resolved(change StateChange) bool {
+	return change.NewStatus == "healthy" || change.NewStatus == "removed"
+}
+
+// Colors of chat messages by the new status of a check.
+const (
+	colorHealthy   = "#2eb886"
+	colorDegraded  = "#daa038"
+	colorUnhealthy = "#a30200"
+)
+
+// statusColor returns the chat message color for status.
+func statusColor(status string) string {
+	switch status {
+	case "healthy", "removed":
+		return colorHealthy
+	case "degraded":
+		return colorDegraded
+	default:
+		return colorUnhealthy
+	}
+}
+
+// changeTitle summarizes change in one line for chat messages.
+func changeTitle(change StateChange) string {
+	return fmt.Sprintf("%s (%s) is %s", change.Name, change.Address, change.NewStatus)
+}
+
+// changeDetails describes the transition of change and its error or warning.
+func changeDetails(change StateChange) string {
+	details := fmt.Sprintf("%s → %s", change.OldStatus, change.NewStatus)
+	if change.Error != "" {
+		details += ": " + change.Error
+	} else if change.Warning != "" {
+		details += ": " + change.Warning
+	}
+	return details
+}
+
+// failingChecksText lists the failing checks of change for chat messages.
+func failingChecksText(change StateChange) string {
+	if len(change.FailingChecks) == 0 {
+		return "none"
+	}
+	return strings.Join(change.FailingChecks, ", ")
+}
+
+// dispatcher fans state changes out to the configured notifiers. Every
+// notifier has its own queues and workers, so a slow target does not hold up
+// the others. A concurrent notifier gets several workers, but all changes of
+// a check go to the same one, so each target receives them in order.
+type dispatcher struct {
+	baseURL        string
+	deadLetterFile string
+	targets        []*notifyTarget
+	wg             sync.WaitGroup
+
+	mu sync.Mutex // serializes writes to the dead-letter file
+}
+
+type notifyTarget struct {
+	cfg      NotifierConfig
+	notifier notifier
+	queues   []chan StateChange
+}
+
+// newNotifyTarget creates the queues of n, one per worker.
+func newNotifyTarget(cfg NotifierConfig, n notifier) *notifyTarget {
+	workers := 1
+	if concurrent, ok := n.(concurrentNotifier); ok && concurrent.concurrency() > 1 {
+		workers = concurrent.concurrency()
+	}
+	target := &notifyTarget{cfg: cfg, notifier: n}
+	for i := 0; i < workers; i++ {
+		target.queues = append(target.queues, make(chan StateChange, notifyQueueSize))
+	}
+	return target
+}
+
+// queue returns the queue of the worker that delivers the changes of the
+// check named name.
+func (target *notifyTarget) queue(name string) chan StateChange {
+	if len(target.queues) == 1 {
+		return target.queues[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return target.queues[h.Sum32()%uint32(len(target.queues))]
+}
+
+// newDispatcher creates the notifiers configured in cfg. It returns nil when
+// no notifiers are configured.
+func newDispatcher(cfg NotificationsConfig) (*dispatcher, error) {
+	if len(cfg.Notifiers) == 0 {
+		return nil, nil
+	}
+
+	d := &dispatcher{baseURL: cfg.BaseURL, deadLetterFile: cfg.DeadLetterFile}
+	for _, notifierCfg := range cfg.Notifiers {
+		n, err := newNotifier(notifierCfg)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", notifierCfg.Name, err)
+		}
+		d.targets = append(d.targets, newNotifyTarget(notifierCfg, n))
+	}
+	return d, nil
+}
+
+// start launches the delivery workers of every notifier. failing lists the checks
+// that are already failing, such as after a config reload, for notifiers
+// that keep track of them.
+func (d *dispatcher) start(failing []StateChange) {
+	for i := range failing {
+		failing[i] = d.withURL(failing[i])
+	}
+	for _, target := range d.targets {
+		if background, ok := target.notifier.(backgroundNotifier); ok {
+			background.start(failing)
+		}
+		for _, queue := range target.queues {
+			d.wg.Add(1)
+			go d.worker(target, queue)
+		}
+	}
+}
+
+// stop closes the queues and stops background work. Queued notifications
+// are still delivered in the background; use wait to block until they are.
+func (d *dispatcher) stop() {
+	for _, target := range d.targets {
+		for _, queue := range target.queues {
+			close(queue)
+		}
+		if background, ok := target.notifier.(backgroundNotifier); ok {
+			background.stop()
+		}
+	}
+}
+
+// wait blocks until the workers have drained their queues after stop.
+func (d *dispatcher) wait() {
+	d.wg.Wait()
+}
+
+// notify queues change for every notifier without blocking. A change that
+// does not fit into a full queue goes to the dead-letter log.
+func (d *dispatcher) notify(change StateChange) {
+	change = d.withURL(change)
+	for _, target := range d.targets {
+		select {
+		case target.queue(change.Name) <- change:
+		default:
+			d.deadLetter(target.cfg.Name, change, errors.New("notification queue full"))
+		}
+	}
+}
+
+// withURL links change to its check when a base URL is configured.
+func (d *dispatcher) withURL(change StateChange) StateChange {
+	if d.baseURL != "" {
+		change.URL = strings.TrimRight(d.baseURL, "/") + "/health/check/" + url.PathEscape(change.Name)
+	}
+	return change
+}
+
+func (d *dispatcher) worker(target *notifyTarget, queue <-chan StateChange) {
+	defer d.wg.Done()
+	for change := range queue {
+		changes := []StateChange{change}
+		if target.cfg.BatchWindow > 0 {
+			changes = collectBatch(queue, changes, target.cfg.BatchWindow)
+		}
+		d.deliver(target, changes)
+	}
+}
+
+// collectBatch appends the changes that arrive on queue within window to
+// changes. It returns early when queue is closed.
+func collectBatch(queue <-chan StateChange, changes []StateChange, window time.Duration) []StateChange {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for {
+		select {
+		case change, ok := <-queue:
+			if !ok {
+				return changes
+			}
+			changes = append(changes, change)
+		case <-timer.C:
+			return changes
+		}
+	}
+}
+
+// send delivers changes to the notifier of target in one call.
+func (target *notifyTarget) send(ctx context.Context, changes []StateChange) error {
+	if len(changes) == 1 {
+		return target.notifier.notify(ctx, changes[0])
+	}
+	batch, ok := target.notifier.(batchNotifier)
+	if !ok {
+		return fmt.Errorf("%s notifier does not support batches", target.cfg.Type)
+	}
+	return batch.notifyBatch(ctx, changes)
+}
+
+// deliver sends changes to target, retrying with exponential backoff, and
+// records them in the dead-letter log when every attempt failed.
+func (d *dispatcher) deliver(target *notifyTarget, changes []StateChange) {
+	timeout := target.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	attempts := target.cfg.Attempts
+	if attempts <= 0 {
+		attempts = defaultNotifyAttempts
+	}
+	backoff := target.cfg.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultNotifyBackoff
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = target.send(ctx, changes)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt < attempts {
+			log.Printf("Notifier %q: attempt %d of %d failed, retrying in %s: %v", target.cfg.Name, attempt, attempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	err = fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	for _, change := range changes {
+		d.deadLetter(target.cfg.Name, change, err)
+	}
+}
+
+// deadLetter logs a notification that could not be delivered and appends it
+// to the dead-letter file, if one is configured.
+func (d *dispatcher) deadLetter(name string, change StateChange, err error) {
+	log.Printf("Notifier %q: dropped notification for %q (%s -> %s): %v", name, change.Name, change.OldStatus, change.NewStatus, err)
+	if d.deadLetterFile == "" {
+		return
+	}
+
+	data, marshalErr := json.Marshal(DeadLetter{
+		Time:     time.Now().Format(time.RFC3339),
+		Notifier: name,
+		Error:    err.Error(),
+		Change:   change,
+	})
+	if marshalErr != nil {
+		log.Printf("Failed to encode dead letter: %v", marshalErr)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if writeErr := appendLine(d.deadLetterFile, data); writeErr != nil {
+		log.Printf("Failed to write dead-letter file: %v", writeErr)
+	}
+}
+
+// appendLine appends data and a newline to the file at path.
+func appendLine(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
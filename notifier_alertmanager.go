@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultResendInterval is how often firing alerts are re-sent.
+	defaultResendInterval = time.Minute
+	// alertExpiryIntervals is the number of resend intervals after which
+	// Alertmanager resolves an alert that was not re-sent, as Prometheus does.
+	alertExpiryIntervals = 4
+	// alertName is the alertname label of every alert.
+	alertName = "PortGuardCheckFailed"
+)
+
+// alertmanagerNotifier pushes alerts for failing checks to Alertmanager and
+// keeps re-sending them until the checks recover.
+type alertmanagerNotifier struct {
+	cfg    *AlertmanagerNotifier
+	client *http.Client
+
+	// mu guards firing and serializes requests, so a resend can never
+	// overtake the end of an alert.
+	mu     sync.Mutex
+	firing map[string]firingAlert
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+type firingAlert struct {
+	change   StateChange
+	startsAt string
+}
+
+// alertmanagerAlert is an alert of the Alertmanager v2 API.
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func newAlertmanagerNotifier(cfg *AlertmanagerNotifier) *alertmanagerNotifier {
+	return &alertmanagerNotifier{
+		cfg:    cfg,
+		client: &http.Client{},
+		firing: make(map[string]firingAlert),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// resendInterval returns how often firing alerts are re-sent.
+func (n *alertmanagerNotifier) resendInterval() time.Duration {
+	if n.cfg.ResendInterval > 0 {
+		return n.cfg.ResendInterval
+	}
+	return defaultResendInterval
+}
+
+// start records the checks that are already failing and begins re-sending
+// the firing alerts.
+func (n *alertmanagerNotifier) start(failing []StateChange) {
+	n.mu.Lock()
+	for _, change := range failing {
+		n.firing[dedupKey(change)] = firingAlert{change: change, startsAt: change.Timestamp}
+	}
+	n.mu.Unlock()
+
+	go n.resendLoop()
+}
+
+func (n *alertmanagerNotifier) stop() {
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+	})
+}
+
+// notify fires the alert of a failing check and ends it when the check
+// recovers or is removed. The alert keeps its start time while the check stays failing.
+func (n *alertmanagerNotifier) notify(ctx context.Context, change StateChange) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := dedupKey(change)
+	now := time.Now()
+	var alert alertmanagerAlert
+	if resolved(change) {
+		alert = n.alert(change, n.firing[key].startsAt)
+		alert.EndsAt = now.Format(time.RFC3339Nano)
+		delete(n.firing, key)
+	} else {
+		startsAt := change.Timestamp
+		if previous, ok := n.firing[key]; ok {
+			startsAt = previous.startsAt
+		}
+		n.firing[key] = firingAlert{change: change, startsAt: startsAt}
+		alert = n.alert(change, startsAt)
+		alert.EndsAt = n.expiry(now)
+	}
+	return n.post(ctx, []alertmanagerAlert{alert})
+}
+
+func (n *alertmanagerNotifier) resendLoop() {
+	ticker := time.NewTicker(n.resendInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-ticker.C:
+			if err := n.resend(); err != nil {
+				log.Printf("Alertmanager notifier: failed to re-send firing alerts: %v", err)
+			}
+		}
+	}
+}
+
+// resend posts every firing alert again with a new expiry.
+func (n *alertmanagerNotifier) resend() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.firing) == 0 {
+		return nil
+	}
+
+	expiry := n.expiry(time.Now())
+	alerts := make([]alertmanagerAlert, 0, len(n.firing))
+	for _, firing := range n.firing {
+		alert := n.alert(firing.change, firing.startsAt)
+		alert.EndsAt = expiry
+		alerts = append(alerts, alert)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultNotifyTimeout)
+	defer cancel()
+	return n.post(ctx, alerts)
+}
+
+// expiry returns the end time of a firing alert sent at now.
+func (n *alertmanagerNotifier) expiry(now time.Time) string {
+	return now.Add(alertExpiryIntervals * n.resendInterval()).Format(time.RFC3339Nano)
+}
+
+// alert returns the alert of change. Its labels only depend on the check,
+// so every status of a check updates the same alert.
+func (n *alertmanagerNotifier) alert(change StateChange, startsAt string) alertmanagerAlert {
+	severity := change.Severity
+	if severity == "" {
+		severity = severityCritical
+	}
+	labels := map[string]string{
+		"alertname": alertName,
+		"check":     change.Name,
+		"instance":  change.Address,
+		"host":      change.Host,
+		"port":      strconv.Itoa(change.Port),
+		"severity":  severity,
+	}
+	if len(change.Tags) > 0 {
+		labels["tags"] = strings.Join(change.Tags, ",")
+	}
+	for name, value := range n.cfg.Labels {
+		labels[name] = value
+	}
+	for name, value := range labels {
+		if value == "" {
+			delete(labels, name)
+		}
+	}
+
+	annotations := map[string]string{
+		"summary":     changeTitle(change),
+		"description": changeDetails(change),
+		"status":      change.NewStatus,
+	}
+	if change.Description != "" {
+		annotations["check_description"] = change.Description
+	}
+
+	return alertmanagerAlert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     startsAt,
+		GeneratorURL: change.URL,
+	}
+}
+
+// post sends alerts to the Alertmanager v2 API. Callers must hold n.mu.
+func (n *alertmanagerNotifier) post(ctx context.Context, alerts []alertmanagerAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimRight(n.cfg.URL, "/") + "/api/v2/alerts"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid alertmanager request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/json")
+	return sendNotification(n.client, req)
+}
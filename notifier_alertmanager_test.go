@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startFakeAlertmanager returns the URL of a stub Alertmanager and the
+// channel receiving every posted batch of alerts.
+func startFakeAlertmanager(t *testing.T) (string, chan []alertmanagerAlert) {
+	t.Helper()
+
+	posts := make(chan []alertmanagerAlert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var alerts []alertmanagerAlert
+		_ = json.NewDecoder(r.Body).Decode(&alerts)
+		posts <- alerts
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, posts
+}
+
+func receiveAlerts(t *testing.T, posts chan []alertmanagerAlert) []alertmanagerAlert {
+	t.Helper()
+	select {
+	case alerts := <-posts:
+		return alerts
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for alerts")
+		return nil
+	}
+}
+
+func TestAlertmanagerNotifier(t *testing.T) {
+	url, posts := startFakeAlertmanager(t)
+
+	n := newAlertmanagerNotifier(&AlertmanagerNotifier{
+		URL:            url + "/",
+		ResendInterval: 50 * time.Millisecond,
+		Labels:         map[string]string{"team": "mail"},
+	})
+	n.start(nil)
+	defer n.stop()
+
+	down := StateChange{
+		Name: "SMTP", Host: "10.0.0.2", Port: 25, Address: "10.0.0.2:25", Tags: []string{"mail", "smtp"},
+		OldStatus: "healthy", NewStatus: "unhealthy", Error: "connection refused",
+		Timestamp: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}
+	if err := n.notify(context.Background(), down); err != nil {
+		t.Fatalf("notify() error: %v", err)
+	}
+
+	alerts := receiveAlerts(t, posts)
+	if len(alerts) != 1 {
+		t.Fatalf("Got %d alerts, want 1", len(alerts))
+	}
+	wantLabels := map[string]string{
+		"alertname": alertName, "check": "SMTP", "instance": "10.0.0.2:25", "host": "10.0.0.2",
+		"port": "25", "severity": severityCritical, "tags": "mail,smtp", "team": "mail",
+	}
+	for name, want := range wantLabels {
+		if got := alerts[0].Labels[name]; got != want {
+			t.Errorf("Label %s = %q, want %q", name, got, want)
+		}
+	}
+	if alerts[0].StartsAt != down.Timestamp {
+		t.Errorf("StartsAt = %q, want %q", alerts[0].StartsAt, down.Timestamp)
+	}
+	if endsAt, err := time.Parse(time.RFC3339, alerts[0].EndsAt); err != nil || !endsAt.After(time.Now()) {
+		t.Errorf("EndsAt = %q, want a time in the future for a firing alert", alerts[0].EndsAt)
+	}
+
+	// While firing, the alert is re-sent with the original start time
+	resent := receiveAlerts(t, posts)
+	if len(resent) != 1 || resent[0].Labels["check"] != "SMTP" || resent[0].StartsAt != down.Timestamp {
+		t.Errorf("Re-sent alerts = %+v, want the SMTP alert", resent)
+	}
+
+	up := down
+	up.OldStatus, up.NewStatus, up.Error = "unhealthy", "healthy", ""
+	up.Timestamp = time.Now().Format(time.RFC3339)
+	if err := n.notify(context.Background(), up); err != nil {
+		t.Fatalf("notify() error: %v", err)
+	}
+
+	// Skip a resend that may have been queued before the recovery
+	for {
+		alerts = receiveAlerts(t, posts)
+		if alerts[0].Annotations["status"] == "healthy" {
+			break
+		}
+	}
+	if endsAt, err := time.Parse(time.RFC3339, alerts[0].EndsAt); err != nil || endsAt.After(time.Now()) {
+		t.Errorf("EndsAt = %q, want the recovery time", alerts[0].EndsAt)
+	}
+	if alerts[0].StartsAt != down.Timestamp {
+		t.Errorf("StartsAt of the resolved alert = %q, want %q", alerts[0].StartsAt, down.Timestamp)
+	}
+
+	select {
+	case alerts := <-posts:
+		t.Errorf("Alerts re-sent after recovery: %+v", alerts)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestAlertmanagerNotifierResendsFailingOnStart(t *testing.T) {
+	url, posts := startFakeAlertmanager(t)
+
+	n := newAlertmanagerNotifier(&AlertmanagerNotifier{URL: url, ResendInterval: 50 * time.Millisecond})
+	n.start([]StateChange{{Name: "IMAP", Address: "10.0.0.2:143", OldStatus: "unknown", NewStatus: "unhealthy"}})
+	defer n.stop()
+
+	alerts := receiveAlerts(t, posts)
+	if len(alerts) != 1 || alerts[0].Labels["check"] != "IMAP" {
+		t.Errorf("Alerts = %+v, want the already failing IMAP check", alerts)
+	}
+}
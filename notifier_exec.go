@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// execOutputLimit caps the bytes of stdout and stderr each that are
+	// logged for a command.
+	execOutputLimit = 8192
+	// execWaitDelay is how long a command that timed out, or that exited
+	// while a child process keeps its output open, is waited for.
+	execWaitDelay = time.Second
+)
+
+// execNotifier runs a command for every state change, e.g. a remediation
+// script that restarts a service.
+type execNotifier struct {
+	name string
+	cfg  *ExecNotifier
+}
+
+func newExecNotifier(name string, cfg *ExecNotifier) (*execNotifier, error) {
+	if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+		return nil, errors.New("command must not be empty")
+	}
+	return &execNotifier{name: name, cfg: cfg}, nil
+}
+
+// concurrency returns how many commands may run at once.
+func (n *execNotifier) concurrency() int {
+	if n.cfg.MaxConcurrent > 0 {
+		return n.cfg.MaxConcurrent
+	}
+	return 1
+}
+
+// notify runs the command with change on stdin and in the environment. The
+// output of the command is logged, and a non-zero exit status is an error.
+func (n *execNotifier) notify(ctx context.Context, change StateChange) error {
+	input, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, n.cfg.Command[0], n.cfg.Command[1:]...)
+	cmd.Env = os.Environ()
+	for name, value := range n.cfg.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.Env = append(cmd.Env, execEnv(n.name, change)...)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &limitedBuffer{limit: execOutputLimit}
+	stderr := &limitedBuffer{limit: execOutputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = execWaitDelay
+
+	start := time.Now()
+	err = cmd.Run()
+	n.logOutput(change, "stdout", stdout)
+	n.logOutput(change, "stderr", stderr)
+	if ctx.Err() != nil {
+		return fmt.Errorf("command %s killed after %s: %w", n.cfg.Command[0], time.Since(start).Round(time.Millisecond), ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("command %s failed: %w", n.cfg.Command[0], err)
+	}
+	return nil
+}
+
+// logOutput logs every line a command wrote to stream.
+func (n *execNotifier) logOutput(change StateChange, stream string, output *limitedBuffer) {
+	scanner := bufio.NewScanner(bytes.NewReader(output.buf.Bytes()))
+	for scanner.Scan() {
+		log.Printf("Notifier %q: %s %s: %s", n.name, change.Name, stream, scanner.Text())
+	}
+	if output.truncated {
+		log.Printf("Notifier %q: %s %s: output truncated after %d bytes", n.name, change.Name, stream, output.limit)
+	}
+}
+
+// execEnv returns the PORTGUARD_* environment variables describing change.
+// Every variable is set, empty if the change has no value for it, and lists
+// are comma-separated.
+func execEnv(notifierName string, change StateChange) []string {
+	vars := []struct {
+		name  string
+		value string
+	}{
+		{"PORTGUARD_NOTIFIER", notifierName},
+		{"PORTGUARD_CHECK_NAME", change.Name},
+		{"PORTGUARD_CHECK_HOST", change.Host},
+		{"PORTGUARD_CHECK_PORT", strconv.Itoa(change.Port)},
+		{"PORTGUARD_CHECK_ADDRESS", change.Address},
+		{"PORTGUARD_CHECK_DESCRIPTION", change.Description},
+		{"PORTGUARD_CHECK_SEVERITY", change.Severity},
+		{"PORTGUARD_CHECK_GROUPS", strings.Join(change.Groups, ",")},
+		{"PORTGUARD_CHECK_TAGS", strings.Join(change.Tags, ",")},
+		{"PORTGUARD_CHECK_URL", change.URL},
+		{"PORTGUARD_OLD_STATUS", change.OldStatus},
+		{"PORTGUARD_NEW_STATUS", change.NewStatus},
+		{"PORTGUARD_ERROR", change.Error},
+		{"PORTGUARD_WARNING", change.Warning},
+		{"PORTGUARD_TIMESTAMP", change.Timestamp},
+		{"PORTGUARD_FAILING_CHECKS", strings.Join(change.FailingChecks, ",")},
+	}
+
+	env := make([]string, 0, len(vars))
+	for _, v := range vars {
+		env = append(env, v.name+"="+v.value)
+	}
+	return env
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a chatty command cannot flood the log.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	script := `echo "$PORTGUARD_CHECK_NAME $PORTGUARD_CHECK_PORT $PORTGUARD_OLD_STATUS $PORTGUARD_NEW_STATUS $PORTGUARD_CHECK_TAGS $TEAM" > "$OUT"
+cat >> "$OUT"
+echo "restarting postfix"
+echo "postfix: not running" >&2`
+
+	n, err := newExecNotifier("restart", &ExecNotifier{
+		Command: []string{"/bin/sh", "-c", script},
+		Env:     map[string]string{"OUT": out, "TEAM": "mail"},
+	})
+	if err != nil {
+		t.Fatalf("newExecNotifier() error: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	change := StateChange{
+		Name: "SMTP", Host: "10.0.0.2", Port: 25, Address: "10.0.0.2:25", Tags: []string{"mail", "smtp"},
+		OldStatus: "healthy", NewStatus: "unhealthy", Error: "connection refused",
+	}
+	if err := n.notify(context.Background(), change); err != nil {
+		t.Fatalf("notify() error: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read command output: %v", err)
+	}
+	env, input, _ := strings.Cut(string(data), "\n")
+	if env != "SMTP 25 healthy unhealthy mail,smtp mail" {
+		t.Errorf("Environment = %q, want check details and configured variables", env)
+	}
+	var got StateChange
+	if err := json.Unmarshal([]byte(input), &got); err != nil {
+		t.Fatalf("stdin is not a JSON state change: %v\n%s", err, input)
+	}
+	if got.Name != "SMTP" || got.Error != "connection refused" {
+		t.Errorf("stdin = %+v, want the SMTP change", got)
+	}
+
+	for _, want := range []string{
+		`Notifier "restart": SMTP stdout: restarting postfix`,
+		`Notifier "restart": SMTP stderr: postfix: not running`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Log does not contain %q:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestExecNotifierErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		wantErr string
+	}{
+		{name: "exit status", command: []string{"/bin/sh", "-c", "exit 3"}, wantErr: "exit status 3"},
+		{name: "timeout", command: []string{"/bin/sh", "-c", "sleep 10"}, wantErr: "killed after"},
+		{name: "missing program", command: []string{"/nonexistent/restart.sh"}, wantErr: "no such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newExecNotifier("restart", &ExecNotifier{Command: tt.command})
+			if err != nil {
+				t.Fatalf("newExecNotifier() error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err = n.notify(ctx, StateChange{Name: "SMTP"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("notify() error = %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("notify() took %s, want the command to be killed", elapsed)
+			}
+		})
+	}
+}
+
+func TestExecNotifierQueues(t *testing.T) {
+	n, err := newExecNotifier("restart", &ExecNotifier{Command: []string{"true"}, MaxConcurrent: 4})
+	if err != nil {
+		t.Fatalf("newExecNotifier() error: %v", err)
+	}
+	target := newNotifyTarget(NotifierConfig{Name: "restart", Type: notifierTypeExec}, n)
+	if len(target.queues) != 4 {
+		t.Fatalf("Got %d queues, want 4", len(target.queues))
+	}
+
+	used := make(map[chan StateChange]bool)
+	for _, name := range []string{"SMTP", "IMAP", "POP3", "Submission", "Sieve", "LDAP"} {
+		queue := target.queue(name)
+		if target.queue(name) != queue {
+			t.Errorf("Changes of %s go to different queues", name)
+		}
+		used[queue] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("All checks share one queue, want them spread over the workers")
+	}
+}
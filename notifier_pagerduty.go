@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// defaultEventsURL is the PagerDuty Events API v2 endpoint.
+const defaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// eventsNotifier triggers an incident when a check fails and resolves it when
+// the check recovers, using Events API v2 events.
+type eventsNotifier struct {
+	cfg    *EventsNotifier
+	client *http.Client
+}
+
+// eventsMessage is an Events API v2 event. Resolve events only carry the
+// routing and dedup keys.
+type eventsMessage struct {
+	RoutingKey  string         `json:"routing_key"`
+	EventAction string         `json:"event_action"`
+	DedupKey    string         `json:"dedup_key"`
+	Payload     *eventsPayload `json:"payload,omitempty"`
+	Client      string         `json:"client,omitempty"`
+	ClientURL   string         `json:"client_url,omitempty"`
+	Links       []eventsLink   `json:"links,omitempty"`
+}
+
+type eventsPayload struct {
+	Summary       string      `json:"summary"`
+	Source        string      `json:"source"`
+	Severity      string      `json:"severity"`
+	Timestamp     string      `json:"timestamp,omitempty"`
+	Component     string      `json:"component"`
+	Class         string      `json:"class"`
+	CustomDetails StateChange `json:"custom_details"`
+}
+
+type eventsLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+func newEventsNotifier(cfg *EventsNotifier) *eventsNotifier {
+	return &eventsNotifier{cfg: cfg, client: &http.Client{}}
+}
+
+func (n *eventsNotifier) notify(ctx context.Context, change StateChange) error {
+	body, err := json.Marshal(newEventsMessage(n.cfg.RoutingKey, change))
+	if err != nil {
+		return err
+	}
+
+	url := n.cfg.URL
+	if url == "" {
+		url = defaultEventsURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid events request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/json")
+	return sendNotification(n.client, req)
+}
+
+// dedupKey identifies the incident of a check. It is derived from the
+// check's name, host and port, so it stays the same across restarts.
+func dedupKey(change StateChange) string {
+	return fmt.Sprintf("portguard:%s@%s", change.Name, change.Address)
+}
+
+// newEventsMessage returns the event for change: resolve when the check is
+// healthy again, trigger otherwise. A degraded check triggers a warning.
+func newEventsMessage(routingKey string, change StateChange) eventsMessage {
+	message := eventsMessage{
+		RoutingKey:  routingKey,
+		EventAction: "resolve",
+		DedupKey:    dedupKey(change),
+	}
+	if resolved(change) {
+		return message
+	}
+
+	severity := change.Severity
+	if severity == "" {
+		severity = severityCritical
+	}
+	if change.NewStatus == "degraded" && severity == severityCritical {
+		severity = severityWarning
+	}
+	summary := changeTitle(change)
+	if change.Error != "" {
+		summary += ": " + change.Error
+	} else if change.Warning != "" {
+		summary += ": " + change.Warning
+	}
+
+	message.EventAction = "trigger"
+	message.Payload = &eventsPayload{
+		Summary:       summary,
+		Source:        change.Address,
+		Severity:      severity,
+		Timestamp:     change.Timestamp,
+		Component:     change.Name,
+		Class:         "port check",
+		CustomDetails: change,
+	}
+	message.Client = "PortGuard"
+	if change.URL != "" {
+		message.ClientURL = change.URL
+		message.Links = []eventsLink{{Href: change.URL, Text: "PortGuard check status"}}
+	}
+	return message
+}
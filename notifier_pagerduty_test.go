@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventsNotifier(t *testing.T) {
+	events := make(chan eventsMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event eventsMessage
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":"success","message":"Event processed"}`))
+	}))
+	defer server.Close()
+
+	n := newEventsNotifier(&EventsNotifier{URL: server.URL + "/v2/enqueue", RoutingKey: "R0UT1NGK3Y"})
+	down := StateChange{
+		Name: "SMTP", Host: "10.0.0.2", Port: 25, Address: "10.0.0.2:25",
+		OldStatus: "healthy", NewStatus: "unhealthy", Error: "connection refused",
+		Timestamp: "2025-01-01T00:00:00Z", URL: "https://portguard.example.com/health/check/SMTP",
+	}
+	up := down
+	up.OldStatus, up.NewStatus, up.Error = "unhealthy", "healthy", ""
+
+	if err := n.notify(context.Background(), down); err != nil {
+		t.Fatalf("notify() trigger error: %v", err)
+	}
+	trigger := <-events
+	if trigger.EventAction != "trigger" || trigger.RoutingKey != "R0UT1NGK3Y" {
+		t.Errorf("Trigger event = %+v, want trigger with routing key", trigger)
+	}
+	if trigger.Payload == nil {
+		t.Fatal("Trigger event has no payload")
+	}
+	if trigger.Payload.Summary != "SMTP (10.0.0.2:25) is unhealthy: connection refused" || trigger.Payload.Source != "10.0.0.2:25" {
+		t.Errorf("Payload = %+v, want summary and source of the check", trigger.Payload)
+	}
+	if trigger.Payload.Severity != severityCritical {
+		t.Errorf("Severity = %q, want 'critical'", trigger.Payload.Severity)
+	}
+	if len(trigger.Links) != 1 || trigger.Links[0].Href != down.URL {
+		t.Errorf("Links = %+v, want link to the check", trigger.Links)
+	}
+
+	if err := n.notify(context.Background(), up); err != nil {
+		t.Fatalf("notify() resolve error: %v", err)
+	}
+	resolve := <-events
+	if resolve.EventAction != "resolve" || resolve.Payload != nil {
+		t.Errorf("Resolve event = %+v, want resolve without payload", resolve)
+	}
+	if resolve.DedupKey != trigger.DedupKey || resolve.DedupKey != "portguard:SMTP@10.0.0.2:25" {
+		t.Errorf("Dedup keys = %q/%q, want the same key for trigger and resolve", trigger.DedupKey, resolve.DedupKey)
+	}
+}
+
+func TestNewEventsMessageSeverity(t *testing.T) {
+	tests := []struct {
+		severity  string
+		status    string
+		wantEvent string
+		want      string
+	}{
+		{severity: "", status: "unhealthy", wantEvent: "trigger", want: severityCritical},
+		{severity: severityWarning, status: "unhealthy", wantEvent: "trigger", want: severityWarning},
+		{severity: severityInfo, status: "unhealthy", wantEvent: "trigger", want: severityInfo},
+		{severity: severityCritical, status: "degraded", wantEvent: "trigger", want: severityWarning},
+		{severity: severityInfo, status: "degraded", wantEvent: "trigger", want: severityInfo},
+		{severity: severityCritical, status: "healthy", wantEvent: "resolve"},
+		{severity: severityCritical, status: "removed", wantEvent: "resolve"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity+" "+tt.status, func(t *testing.T) {
+			message := newEventsMessage("key", StateChange{Name: "SMTP", Address: "10.0.0.2:25", Severity: tt.severity, NewStatus: tt.status})
+			if message.EventAction != tt.wantEvent {
+				t.Fatalf("EventAction = %q, want %q", message.EventAction, tt.wantEvent)
+			}
+			if tt.want != "" && message.Payload.Severity != tt.want {
+				t.Errorf("Severity = %q, want %q", message.Payload.Severity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// slackNotifier posts state changes to a Slack-compatible incoming webhook.
+// Mattermost accepts the same message format.
+type slackNotifier struct {
+	cfg    *ChatNotifier
+	client *http.Client
+}
+
+// slackMessage is the body of an incoming webhook request.
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text"`
+	Fields    []slackField `json:"fields"`
+	Footer    string       `json:"footer"`
+	Timestamp int64        `json:"ts,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func newSlackNotifier(cfg *ChatNotifier) *slackNotifier {
+	return &slackNotifier{cfg: cfg, client: &http.Client{}}
+}
+
+func (n *slackNotifier) notify(ctx context.Context, change StateChange) error {
+	body, err := json.Marshal(newSlackMessage(n.cfg, change))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/json")
+	return sendNotification(n.client, req)
+}
+
+// newSlackMessage formats change as a colored attachment with the list of
+// failing checks, linked to the check when a base URL is configured.
+func newSlackMessage(cfg *ChatNotifier, change StateChange) slackMessage {
+	title := changeTitle(change)
+	attachment := slackAttachment{
+		Fallback:  title,
+		Color:     statusColor(change.NewStatus),
+		Title:     title,
+		TitleLink: change.URL,
+		Text:      changeDetails(change),
+		Fields: []slackField{
+			{Title: "Severity", Value: change.Severity, Short: true},
+			{Title: "Failing checks", Value: failingChecksText(change), Short: true},
+		},
+		Footer: "PortGuard",
+	}
+	if t, err := time.Parse(time.RFC3339, change.Timestamp); err == nil {
+		attachment.Timestamp = t.Unix()
+	}
+
+	return slackMessage{
+		Channel:     cfg.Channel,
+		Username:    cfg.Username,
+		Attachments: []slackAttachment{attachment},
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlackNotifier(t *testing.T) {
+	messages := make(chan slackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var message slackMessage
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		messages <- message
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		change    StateChange
+		wantColor string
+		wantText  string
+		wantList  string
+	}{
+		{
+			name: "down",
+			change: StateChange{
+				Name: "SMTP", Address: "10.0.0.2:25", Severity: severityCritical,
+				OldStatus: "healthy", NewStatus: "unhealthy", Error: "connection refused",
+				Timestamp: "2025-01-01T00:00:00Z", FailingChecks: []string{"IMAP", "SMTP"},
+				URL: "https://portguard.example.com/health/check/SMTP",
+			},
+			wantColor: colorUnhealthy,
+			wantText:  "healthy → unhealthy: connection refused",
+			wantList:  "IMAP, SMTP",
+		},
+		{
+			name: "degraded",
+			change: StateChange{
+				Name: "API", Address: "api.example.com:443", OldStatus: "healthy", NewStatus: "degraded",
+				Warning: "latency 350ms exceeds warn_latency 200ms", FailingChecks: []string{"API"},
+			},
+			wantColor: colorDegraded,
+			wantText:  "healthy → degraded: latency 350ms exceeds warn_latency 200ms",
+			wantList:  "API",
+		},
+		{
+			name: "recovered",
+			change: StateChange{
+				Name: "SMTP", Address: "10.0.0.2:25", OldStatus: "unhealthy", NewStatus: "healthy",
+			},
+			wantColor: colorHealthy,
+			wantText:  "unhealthy → healthy",
+			wantList:  "none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newSlackNotifier(&ChatNotifier{URL: server.URL, Channel: "#ops", Username: "portguard"})
+			if err := n.notify(context.Background(), tt.change); err != nil {
+				t.Fatalf("notify() unexpected error: %v", err)
+			}
+
+			message := <-messages
+			if message.Channel != "#ops" || message.Username != "portguard" {
+				t.Errorf("Channel/Username = %q/%q, want '#ops'/'portguard'", message.Channel, message.Username)
+			}
+			if len(message.Attachments) != 1 {
+				t.Fatalf("Got %d attachments, want 1", len(message.Attachments))
+			}
+			attachment := message.Attachments[0]
+			if attachment.Color != tt.wantColor {
+				t.Errorf("Color = %q, want %q", attachment.Color, tt.wantColor)
+			}
+			if attachment.Title != changeTitle(tt.change) || attachment.TitleLink != tt.change.URL {
+				t.Errorf("Title = %q (%q), want %q (%q)", attachment.Title, attachment.TitleLink, changeTitle(tt.change), tt.change.URL)
+			}
+			if attachment.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", attachment.Text, tt.wantText)
+			}
+			if len(attachment.Fields) != 2 || attachment.Fields[1].Value != tt.wantList {
+				t.Errorf("Fields = %+v, want failing checks %q", attachment.Fields, tt.wantList)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	smtpTLSStartTLS = "starttls"
+	smtpTLSImplicit = "implicit"
+	smtpTLSNone     = "none"
+
+	// defaultSMTPSubject names the check for a single change and counts the
+	// changes of a batch.
+	defaultSMTPSubject = `[PortGuard] {{if eq (len .Changes) 1}}{{.Name}} ({{.Address}}) is {{.NewStatus}}` +
+		`{{else}}{{len .Changes}} checks changed state{{end}}`
+)
+
+// smtpNotifier sends state changes by email, one message per batch.
+type smtpNotifier struct {
+	cfg     *SMTPNotifier
+	from    *mail.Address
+	to      []*mail.Address
+	subject *template.Template
+}
+
+// emailData is passed to the subject template. The latest change is
+// embedded, so a single-change subject can use {{.Name}} and friends.
+type emailData struct {
+	StateChange
+	Changes []StateChange
+}
+
+func newSMTPNotifier(cfg *SMTPNotifier) (*smtpNotifier, error) {
+	tmpl, err := parseSMTPSubject(cfg.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// Addresses may carry a display name, such as "PortGuard <portguard@example.com>",
+	// which only belongs in the headers; the envelope takes the bare address.
+	n := &smtpNotifier{cfg: cfg, subject: tmpl}
+	if cfg.From != "" {
+		if n.from, err = mail.ParseAddress(cfg.From); err != nil {
+			return nil, fmt.Errorf("invalid from address %q: %w", cfg.From, err)
+		}
+	}
+	for _, to := range cfg.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to address %q: %w", to, err)
+		}
+		n.to = append(n.to, address)
+	}
+	return n, nil
+}
+
+// parseSMTPSubject parses the subject template, or the default one when
+// subject is empty.
+func parseSMTPSubject(subject string) (*template.Template, error) {
+	if subject == "" {
+		subject = defaultSMTPSubject
+	}
+	tmpl, err := template.New("subject").Funcs(templateFuncs).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// smtpPort returns the configured port or the standard port for the TLS mode.
+func smtpPort(cfg *SMTPNotifier) int {
+	if cfg.Port != 0 {
+		return cfg.Port
+	}
+	switch cfg.TLS {
+	case smtpTLSImplicit:
+		return 465
+	case smtpTLSNone:
+		return 25
+	default:
+		return 587
+	}
+}
+
+func (n *smtpNotifier) notify(ctx context.Context, change StateChange) error {
+	return n.notifyBatch(ctx, []StateChange{change})
+}
+
+func (n *smtpNotifier) notifyBatch(ctx context.Context, changes []StateChange) error {
+	message, err := n.message(changes, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := n.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if n.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+	if err := client.Mail(n.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, to := range n.to {
+		if err := client.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", to.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server and secures the connection as configured.
+// The context deadline applies to the whole SMTP session.
+func (n *smtpNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         n.cfg.Host,
+		InsecureSkipVerify: n.cfg.InsecureSkipVerify,
+	}
+	if n.cfg.CAFile != "" {
+		pool, err := loadCAPool(n.cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	address := net.JoinHostPort(n.cfg.Host, strconv.Itoa(smtpPort(n.cfg)))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if n.cfg.TLS == smtpTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	if n.cfg.TLS == "" || n.cfg.TLS == smtpTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("smtp STARTTLS failed: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// message renders the email for changes, in the order they happened.
+func (n *smtpNotifier) message(changes []StateChange, now time.Time) ([]byte, error) {
+	var subject bytes.Buffer
+	latest := changes[len(changes)-1]
+	if err := n.subject.Execute(&subject, emailData{StateChange: latest, Changes: changes}); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+
+	var text strings.Builder
+	for _, change := range changes {
+		fmt.Fprintf(&text, "%s\n  %s\n  Time: %s\n", changeTitle(change), changeDetails(change), change.Timestamp)
+		if change.URL != "" {
+			fmt.Fprintf(&text, "  %s\n", change.URL)
+		}
+		text.WriteString("\n")
+	}
+	fmt.Fprintf(&text, "Failing checks: %s\n", failingChecksText(latest))
+
+	to := make([]string, len(n.to))
+	for i, address := range n.to {
+		to[i] = address.String()
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text.String(), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
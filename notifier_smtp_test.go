@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer records the messages delivered to it.
+type fakeSMTPServer struct {
+	port int
+
+	mu       sync.Mutex
+	auth     []string
+	messages []fakeSMTPMessage
+}
+
+type fakeSMTPMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// startFakeSMTPServer starts an SMTP server on 127.0.0.1. With tlsMode
+// "starttls" it offers STARTTLS, with "implicit" it expects TLS right away.
+func startFakeSMTPServer(t *testing.T, cert tls.Certificate, tlsMode string) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	server := &fakeSMTPServer{port: listener.Addr().(*net.TCPAddr).Port}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if tlsMode == smtpTLSImplicit {
+				conn = tls.Server(conn, tlsConfig)
+			}
+			go server.serve(conn, tlsConfig, tlsMode == smtpTLSStartTLS)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn, tlsConfig *tls.Config, offerStartTLS bool) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	var message fakeSMTPMessage
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250-fake")
+			if offerStartTLS {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			conn = tls.Server(conn, tlsConfig)
+			r = bufio.NewReader(conn)
+			offerStartTLS = false
+		case "AUTH":
+			fields := strings.Fields(line)
+			credentials, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			s.mu.Lock()
+			s.auth = append(s.auth, string(credentials))
+			s.mu.Unlock()
+			reply("235 authenticated")
+		case "MAIL":
+			message.from = strings.TrimPrefix(line, "MAIL FROM:")
+			reply(envelopeReply(message.from))
+		case "RCPT":
+			message.to = append(message.to, strings.TrimPrefix(line, "RCPT TO:"))
+			reply(envelopeReply(message.to[len(message.to)-1]))
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			message.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+// envelopeReply accepts a bare <local@domain> envelope address and rejects
+// anything else, such as an address with a display name, as real MTAs do.
+func envelopeReply(address string) string {
+	inner, ok := strings.CutPrefix(address, "<")
+	if inner, ok = strings.CutSuffix(inner, ">"); !ok || strings.ContainsAny(inner, "<> ") || !strings.Contains(inner, "@") {
+		return "501 invalid address"
+	}
+	return "250 ok"
+}
+
+func (s *fakeSMTPServer) received() []fakeSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTPServer) credentials() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.auth...)
+}
+
+// parseTestMail returns the decoded subject and body of data.
+func parseTestMail(t *testing.T, data string) (string, string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v\n%s", err, data)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("Failed to decode subject: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	return subject, string(body)
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	cert, caFile := newTestCertificate(t, time.Now().Add(24*time.Hour))
+	change := StateChange{
+		Name: "SMTP", Address: "10.0.0.2:25", OldStatus: "healthy", NewStatus: "unhealthy",
+		Error: "connection refused", Timestamp: "2025-01-01T00:00:00Z", FailingChecks: []string{"SMTP"},
+	}
+
+	tests := []struct {
+		name     string
+		tlsMode  string
+		cfg      SMTPNotifier
+		wantErr  string
+		wantAuth bool
+	}{
+		{
+			name:     "starttls with auth",
+			tlsMode:  smtpTLSStartTLS,
+			cfg:      SMTPNotifier{Host: "localhost", CAFile: caFile, Username: "portguard", Password: "secret"},
+			wantAuth: true,
+		},
+		{
+			name:    "implicit tls",
+			tlsMode: smtpTLSImplicit,
+			cfg:     SMTPNotifier{Host: "localhost", TLS: smtpTLSImplicit, CAFile: caFile},
+		},
+		{
+			name:     "plain to localhost",
+			tlsMode:  smtpTLSNone,
+			cfg:      SMTPNotifier{Host: "127.0.0.1", TLS: smtpTLSNone, Username: "portguard", Password: "secret"},
+			wantAuth: true,
+		},
+		{
+			name:    "starttls not offered",
+			tlsMode: smtpTLSNone,
+			cfg:     SMTPNotifier{Host: "localhost"},
+			wantErr: "does not support STARTTLS",
+		},
+		{
+			name:    "untrusted certificate",
+			tlsMode: smtpTLSStartTLS,
+			cfg:     SMTPNotifier{Host: "localhost"},
+			wantErr: "certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startFakeSMTPServer(t, cert, tt.tlsMode)
+			cfg := tt.cfg
+			cfg.Port = server.port
+			cfg.From = "PortGuard <portguard@example.com>"
+			cfg.To = []string{"Ops Team <ops@example.com>", "oncall@example.com"}
+
+			n, err := newSMTPNotifier(&cfg)
+			if err != nil {
+				t.Fatalf("newSMTPNotifier() error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err = n.notify(ctx, change)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("notify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("notify() unexpected error: %v", err)
+			}
+
+			messages := server.received()
+			if len(messages) != 1 {
+				t.Fatalf("Server received %d messages, want 1", len(messages))
+			}
+			if messages[0].from != "<portguard@example.com>" || len(messages[0].to) != 2 || messages[0].to[0] != "<ops@example.com>" {
+				t.Errorf("Envelope = %s -> %v, want bare sender and 2 recipients", messages[0].from, messages[0].to)
+			}
+			for _, header := range []string{"From: \"PortGuard\" <portguard@example.com>\r\n", "To: \"Ops Team\" <ops@example.com>, <oncall@example.com>\r\n"} {
+				if !strings.Contains(messages[0].data, header) {
+					t.Errorf("Message does not contain header %q:\n%s", header, messages[0].data)
+				}
+			}
+			if auth := server.credentials(); tt.wantAuth != (len(auth) == 1 && auth[0] == "\x00portguard\x00secret") {
+				t.Errorf("AUTH = %q, want auth %v", auth, tt.wantAuth)
+			}
+
+			subject, body := parseTestMail(t, messages[0].data)
+			if subject != "[PortGuard] SMTP (10.0.0.2:25) is unhealthy" {
+				t.Errorf("Subject = %q", subject)
+			}
+			if !strings.Contains(body, "healthy → unhealthy: connection refused") {
+				t.Errorf("Body does not describe the change:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestSMTPNotifierBatch(t *testing.T) {
+	cert, _ := newTestCertificate(t, time.Now().Add(24*time.Hour))
+	server := startFakeSMTPServer(t, cert, smtpTLSNone)
+
+	n, err := newSMTPNotifier(&SMTPNotifier{
+		Host:    "127.0.0.1",
+		Port:    server.port,
+		TLS:     smtpTLSNone,
+		From:    "portguard@example.com",
+		To:      []string{"ops@example.com"},
+		Subject: "{{len .Changes}} changes, {{len .FailingChecks}} failing",
+	})
+	if err != nil {
+		t.Fatalf("newSMTPNotifier() error: %v", err)
+	}
+
+	d := &dispatcher{targets: []*notifyTarget{
+		newNotifyTarget(NotifierConfig{Name: "mail", Type: notifierTypeSMTP, BatchWindow: 100 * time.Millisecond}, n),
+	}}
+	d.start(nil)
+
+	var failing []string
+	for _, name := range []string{"SMTP", "IMAP", "POP3"} {
+		failing = append(failing, name)
+		d.notify(StateChange{
+			Name: name, Address: "10.0.0.2:25", OldStatus: "healthy", NewStatus: "unhealthy",
+			FailingChecks: append([]string(nil), failing...),
+		})
+	}
+	d.stop()
+	d.wait()
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("Server received %d messages, want 1 for the batch", len(messages))
+	}
+	subject, body := parseTestMail(t, messages[0].data)
+	if subject != "3 changes, 3 failing" {
+		t.Errorf("Subject = %q, want '3 changes, 3 failing'", subject)
+	}
+	for _, want := range []string{"SMTP (10.0.0.2:25) is unhealthy", "POP3 (10.0.0.2:25) is unhealthy", "Failing checks: SMTP, IMAP, POP3"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Body does not contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// teamsNotifier posts state changes as Adaptive Cards to a Microsoft Teams
+// incoming webhook or Workflows URL.
+type teamsNotifier struct {
+	cfg    *ChatNotifier
+	client *http.Client
+}
+
+// teamsMessage is the body of a Teams webhook request carrying one card.
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+}
+
+func newTeamsNotifier(cfg *ChatNotifier) *teamsNotifier {
+	return &teamsNotifier{cfg: cfg, client: &http.Client{}}
+}
+
+func (n *teamsNotifier) notify(ctx context.Context, change StateChange) error {
+	body, err := json.Marshal(newTeamsMessage(change))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/json")
+	return sendNotification(n.client, req)
+}
+
+// newTeamsMessage formats change as an Adaptive Card. The title container
+// is styled by status, as Adaptive Cards have no free colors, and the card
+// links to the check when a base URL is configured.
+func newTeamsMessage(change StateChange) teamsMessage {
+	facts := []map[string]interface{}{
+		{"title": "Status", "value": changeDetails(change)},
+		{"title": "Severity", "value": change.Severity},
+		{"title": "Failing checks", "value": failingChecksText(change)},
+		{"title": "Time", "value": change.Timestamp},
+	}
+
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []map[string]interface{}{
+			{
+				"type":  "Container",
+				"style": teamsStyle(change.NewStatus),
+				"bleed": true,
+				"items": []map[string]interface{}{
+					{"type": "TextBlock", "text": changeTitle(change), "weight": "Bolder", "size": "Medium", "wrap": true},
+				},
+			},
+			{"type": "FactSet", "facts": facts},
+		},
+	}
+	if change.URL != "" {
+		card.Actions = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "Open in PortGuard", "url": change.URL},
+		}
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     card,
+		}},
+	}
+}
+
+// teamsStyle maps a status to an Adaptive Card container style.
+func teamsStyle(status string) string {
+	switch status {
+	case "healthy", "removed":
+		return "good"
+	case "degraded":
+		return "warning"
+	default:
+		return "attention"
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTeamsNotifier(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		data, _ := json.Marshal(message)
+		bodies <- string(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		change     StateChange
+		wantStyle  string
+		wantAction bool
+	}{
+		{
+			name: "down with link",
+			change: StateChange{
+				Name: "SMTP", Address: "10.0.0.2:25", OldStatus: "healthy", NewStatus: "unhealthy",
+				Error: "connection refused", FailingChecks: []string{"SMTP"},
+				URL: "https://portguard.example.com/health/check/SMTP",
+			},
+			wantStyle:  "attention",
+			wantAction: true,
+		},
+		{
+			name:      "recovered without link",
+			change:    StateChange{Name: "SMTP", Address: "10.0.0.2:25", OldStatus: "unhealthy", NewStatus: "healthy"},
+			wantStyle: "good",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTeamsNotifier(&ChatNotifier{URL: server.URL})
+			if err := n.notify(context.Background(), tt.change); err != nil {
+				t.Fatalf("notify() unexpected error: %v", err)
+			}
+
+			body := <-bodies
+			for _, want := range []string{
+				`"contentType":"application/vnd.microsoft.card.adaptive"`,
+				`"style":"` + tt.wantStyle + `"`,
+				`"text":"SMTP (10.0.0.2:25) is ` + tt.change.NewStatus + `"`,
+				`"value":"` + failingChecksText(tt.change) + `"`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Body does not contain %s:\n%s", want, body)
+				}
+			}
+			if hasAction := strings.Contains(body, `"Action.OpenUrl"`); hasAction != tt.wantAction {
+				t.Errorf("OpenUrl action = %v, want %v", hasAction, tt.wantAction)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the changes it receives and fails the first
+// failures calls.
+type recordingNotifier struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	changes  []StateChange
+}
+
+func (n *recordingNotifier) notify(_ context.Context, change StateChange) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.calls <= n.failures {
+		return errors.New("target unavailable")
+	}
+	n.changes = append(n.changes, change)
+	return nil
+}
+
+func TestNewStateChange(t *testing.T) {
+	result := PortCheckResult{
+		Name:            "SMTP",
+		Host:            "10.0.0.2",
+		Port:            25,
+		Severity:        severityCritical,
+		Status:          "unhealthy",
+		Error:           "connection refused",
+		LastStateChange: "2025-01-01T00:00:00Z",
+	}
+
+	tests := []struct {
+		name          string
+		previous      *PortCheckResult
+		status        string
+		wantChange    bool
+		wantOldStatus string
+	}{
+		{name: "first result healthy", status: "healthy"},
+		{name: "first result unhealthy", status: "unhealthy", wantChange: true, wantOldStatus: "unknown"},
+		{name: "unchanged", previous: &PortCheckResult{Status: "unhealthy"}, status: "unhealthy"},
+		{name: "went down", previous: &PortCheckResult{Status: "healthy"}, status: "unhealthy", wantChange: true, wantOldStatus: "healthy"},
+		{name: "degraded", previous: &PortCheckResult{Status: "healthy"}, status: "degraded", wantChange: true, wantOldStatus: "healthy"},
+		{name: "recovered", previous: &PortCheckResult{Status: "unhealthy"}, status: "healthy", wantChange: true, wantOldStatus: "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := result
+			result.Status = tt.status
+
+			change, ok := newStateChange(tt.previous, result)
+			if ok != tt.wantChange {
+				t.Fatalf("newStateChange() reported change = %v, want %v", ok, tt.wantChange)
+			}
+			if !ok {
+				return
+			}
+			if change.OldStatus != tt.wantOldStatus || change.NewStatus != tt.status {
+				t.Errorf("Status change = %s -> %s, want %s -> %s", change.OldStatus, change.NewStatus, tt.wantOldStatus, tt.status)
+			}
+			if change.Address != "10.0.0.2:25" {
+				t.Errorf("Address = %q, want '10.0.0.2:25'", change.Address)
+			}
+			if change.Error != "connection refused" || change.Timestamp != "2025-01-01T00:00:00Z" {
+				t.Errorf("Error/Timestamp = %q/%q, want result fields", change.Error, change.Timestamp)
+			}
+		})
+	}
+}
+
+func TestResultStoreNotify(t *testing.T) {
+	check := PortCheck{Host: "127.0.0.1", Port: 25, Name: "SMTP", FailureThreshold: 2}
+
+	var changes []StateChange
+	store := newResultStore()
+	store.setNotify(func(change StateChange) {
+		changes = append(changes, change)
+	})
+
+	for _, status := range []string{"healthy", "unhealthy", "unhealthy", "unhealthy", "healthy"} {
+		store.set(check, PortCheckResult{Name: "SMTP", Host: "127.0.0.1", Port: 25, Status: status})
+	}
+
+	// The first failure is held back by the failure threshold
+	if len(changes) != 2 {
+		t.Fatalf("Got %d notifications, want 2: %+v", len(changes), changes)
+	}
+	if changes[0].OldStatus != "healthy" || changes[0].NewStatus != "unhealthy" {
+		t.Errorf("First change = %s -> %s, want healthy -> unhealthy", changes[0].OldStatus, changes[0].NewStatus)
+	}
+	if changes[1].OldStatus != "unhealthy" || changes[1].NewStatus != "healthy" {
+		t.Errorf("Second change = %s -> %s, want unhealthy -> healthy", changes[1].OldStatus, changes[1].NewStatus)
+	}
+	if len(changes[0].FailingChecks) != 1 || changes[0].FailingChecks[0] != "SMTP" {
+		t.Errorf("FailingChecks = %v, want [SMTP]", changes[0].FailingChecks)
+	}
+	if len(changes[1].FailingChecks) != 0 {
+		t.Errorf("FailingChecks after recovery = %v, want none", changes[1].FailingChecks)
+	}
+}
+
+func TestResultStoreRetainNotifiesRemoved(t *testing.T) {
+	checks := []PortCheck{
+		{Host: "127.0.0.1", Port: 25, Name: "SMTP"},
+		{Host: "127.0.0.1", Port: 143, Name: "IMAP"},
+		{Host: "127.0.0.1", Port: 110, Name: "POP3"},
+	}
+
+	var changes []StateChange
+	store := newResultStore()
+	store.setNotify(func(change StateChange) {
+		changes = append(changes, change)
+	})
+
+	store.set(checks[0], PortCheckResult{Name: "SMTP", Host: "127.0.0.1", Port: 25, Status: "unhealthy", Error: "connection refused"})
+	store.set(checks[1], PortCheckResult{Name: "IMAP", Host: "127.0.0.1", Port: 143, Status: "degraded"})
+	store.set(checks[2], PortCheckResult{Name: "POP3", Host: "127.0.0.1", Port: 110, Status: "healthy"})
+	changes = nil
+
+	// Only the failing checks that are dropped are reported
+	store.retain(checks[:1])
+
+	if len(changes) != 1 {
+		t.Fatalf("Got %d notifications, want 1: %+v", len(changes), changes)
+	}
+	change := changes[0]
+	if change.Name != "IMAP" || change.OldStatus != "degraded" || change.NewStatus != "removed" {
+		t.Errorf("Change = %s %s -> %s, want IMAP degraded -> removed", change.Name, change.OldStatus, change.NewStatus)
+	}
+	if change.Address != "127.0.0.1:143" || change.Timestamp == "" {
+		t.Errorf("Address/Timestamp = %q/%q, want the check address and a timestamp", change.Address, change.Timestamp)
+	}
+	if len(change.FailingChecks) != 1 || change.FailingChecks[0] != "SMTP" {
+		t.Errorf("FailingChecks = %v, want [SMTP]", change.FailingChecks)
+	}
+	if !resolved(change) {
+		t.Error("A removed check should resolve its notifications")
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	recorder := &recordingNotifier{failures: 2}
+	d := &dispatcher{
+		baseURL: "https://portguard.example.com/",
+		targets: []*notifyTarget{
+			newNotifyTarget(NotifierConfig{Name: "test", Attempts: 3, RetryBackoff: time.Millisecond}, recorder),
+		},
+	}
+	d.start(nil)
+
+	d.notify(StateChange{Name: "Mail Server", OldStatus: "healthy", NewStatus: "unhealthy"})
+	d.stop()
+	d.wait()
+
+	if recorder.calls != 3 {
+		t.Errorf("Notifier called %d times, want 3", recorder.calls)
+	}
+	if len(recorder.changes) != 1 || recorder.changes[0].Name != "Mail Server" {
+		t.Fatalf("Delivered changes = %+v, want the Mail Server change", recorder.changes)
+	}
+	if want := "https://portguard.example.com/health/check/Mail%20Server"; recorder.changes[0].URL != want {
+		t.Errorf("URL = %q, want %q", recorder.changes[0].URL, want)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	recorder := &recordingNotifier{failures: 100}
+	d := &dispatcher{
+		deadLetterFile: deadLetterFile,
+		targets: []*notifyTarget{
+			newNotifyTarget(NotifierConfig{Name: "ops", Attempts: 2, RetryBackoff: time.Millisecond}, recorder),
+		},
+	}
+	d.start(nil)
+
+	d.notify(StateChange{Name: "SMTP", OldStatus: "healthy", NewStatus: "unhealthy"})
+	d.notify(StateChange{Name: "IMAP", OldStatus: "healthy", NewStatus: "unhealthy"})
+	d.stop()
+	d.wait()
+
+	if recorder.calls != 4 {
+		t.Errorf("Notifier called %d times, want 4", recorder.calls)
+	}
+
+	data, err := os.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatalf("Failed to read dead-letter file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Dead-letter file has %d lines, want 2:\n%s", len(lines), data)
+	}
+
+	var entry DeadLetter
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Failed to decode dead letter: %v", err)
+	}
+	if entry.Notifier != "ops" || entry.Change.Name != "SMTP" {
+		t.Errorf("Dead letter = %+v, want notifier 'ops' and check 'SMTP'", entry)
+	}
+	if !strings.Contains(entry.Error, "giving up after 2 attempts: target unavailable") {
+		t.Errorf("Dead letter error = %q, want attempts and cause", entry.Error)
+	}
+}
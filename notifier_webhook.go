@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// maxNotifyResponseBytes limits how much of an error response is logged.
+const maxNotifyResponseBytes = 512
+
+// templateFuncs are available in notification templates.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// webhookNotifier sends state changes as HTTP requests.
+type webhookNotifier struct {
+	cfg      *WebhookNotifier
+	template *template.Template
+	client   *http.Client
+}
+
+func newWebhookNotifier(cfg *WebhookNotifier) (*webhookNotifier, error) {
+	n := &webhookNotifier{cfg: cfg, client: &http.Client{}}
+	if cfg.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		n.template = tmpl
+	}
+	return n, nil
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, change StateChange) error {
+	body, err := n.body(change)
+	if err != nil {
+		return err
+	}
+
+	method := n.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/json")
+	req.Header.Set("User-Agent", "PortGuard/"+appVersion)
+	for name, value := range n.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return sendNotification(n.client, req)
+}
+
+// body renders the request body for change.
+func (n *webhookNotifier) body(change StateChange) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(change)
+	}
+	var buf bytes.Buffer
+	if err := n.template.Execute(&buf, change); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sendNotification performs req and treats any non-2xx response as an error
+// that includes the start of the response body.
+func sendNotification(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxNotifyResponseBytes))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	change := StateChange{
+		Name:      "SMTP",
+		Host:      "10.0.0.2",
+		Port:      25,
+		Address:   "10.0.0.2:25",
+		OldStatus: "healthy",
+		NewStatus: "unhealthy",
+		Error:     `dial tcp: "connection refused"`,
+		Timestamp: "2025-01-01T00:00:00Z",
+	}
+
+	type request struct {
+		method string
+		header http.Header
+		body   string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{method: r.Method, header: r.Header, body: string(body)}
+		if r.URL.Path == "/fail" {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		cfg        WebhookNotifier
+		wantErr    string
+		wantMethod string
+		wantBody   string
+	}{
+		{
+			name:       "default JSON payload",
+			cfg:        WebhookNotifier{URL: server.URL},
+			wantMethod: http.MethodPost,
+		},
+		{
+			name: "template and headers",
+			cfg: WebhookNotifier{
+				URL:      server.URL,
+				Method:   http.MethodPut,
+				Headers:  map[string]string{"Authorization": "Bearer secret"},
+				Template: `{"text": {{json (printf "%s is %s: %s" .Address .NewStatus .Error)}}}`,
+			},
+			wantMethod: http.MethodPut,
+			wantBody:   `{"text": "10.0.0.2:25 is unhealthy: dial tcp: \"connection refused\""}`,
+		},
+		{
+			name:       "error status",
+			cfg:        WebhookNotifier{URL: server.URL + "/fail"},
+			wantErr:    "unexpected status code 503: maintenance",
+			wantMethod: http.MethodPost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newWebhookNotifier(&tt.cfg)
+			if err != nil {
+				t.Fatalf("newWebhookNotifier() error: %v", err)
+			}
+
+			err = n.notify(context.Background(), change)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("notify() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("notify() unexpected error: %v", err)
+			}
+
+			got := <-requests
+			if got.method != tt.wantMethod {
+				t.Errorf("Method = %s, want %s", got.method, tt.wantMethod)
+			}
+			for name, value := range tt.cfg.Headers {
+				if got.header.Get(name) != value {
+					t.Errorf("Header %s = %q, want %q", name, got.header.Get(name), value)
+				}
+			}
+
+			if tt.wantBody != "" {
+				if got.body != tt.wantBody {
+					t.Errorf("Body = %s, want %s", got.body, tt.wantBody)
+				}
+				return
+			}
+			var payload StateChange
+			if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+				t.Fatalf("Failed to decode payload %q: %v", got.body, err)
+			}
+			if payload.Name != "SMTP" || payload.Address != "10.0.0.2:25" || payload.OldStatus != "healthy" || payload.NewStatus != "unhealthy" {
+				t.Errorf("Payload = %+v, want the state change", payload)
+			}
+		})
+	}
+}
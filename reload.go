@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultWatchInterval is how often the config file is polled for changes
+// when server.watch_config is enabled.
+const defaultWatchInterval = 2 * time.Second
+
+// configReloader serves HTTP requests with the handlers of the active config
+// generation. On reload the new config is loaded and validated first; only
+// then are the handlers and the background scheduler swapped. A config that
+// fails to load leaves the running generation untouched.
+type configReloader struct {
+	configPath    string
+	store         *resultStore
+	watchInterval time.Duration
+
+	handler atomic.Pointer[http.ServeMux]
+
+	mu         sync.Mutex // serializes reloads and guards the fields below
+	cfg        *Config
+	scheduler  *scheduler
+	dispatcher *dispatcher
+	watchStop  chan struct{} // closed to stop the file watcher, nil when not watching
+	generation int
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newConfigReloader(cfg *Config, configPath string) *configReloader {
+	return &configReloader{
+		configPath:    configPath,
+		store:         newResultStore(),
+		watchInterval: defaultWatchInterval,
+		cfg:           cfg,
+		stopCh:        make(chan struct{}),
+	}
+}
+
+// start activates the initial config and begins listening for SIGHUP.
+func (r *configReloader) start() {
+	r.mu.Lock()
+	r.activate(r.cfg)
+	r.mu.Unlock()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go r.handleSignals(signals)
+}
+
+// stop ends signal handling, file watching and background checks.
+func (r *configReloader) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.scheduler != nil {
+			r.scheduler.stop()
+		}
+		r.store.setNotify(nil)
+		if r.dispatcher != nil {
+			r.dispatcher.stop()
+		}
+	})
+}
+
+func (r *configReloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.Load().ServeHTTP(w, req)
+}
+
+// config returns the active configuration.
+func (r *configReloader) config() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// reload loads the config file again and swaps it in when it is valid.
+func (r *configReloader) reload() error {
+	cfg, err := loadConfig(r.configPath)
+	if err == nil && len(cfg.Checks) == 0 {
+		err = errors.New("no port checks configured")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Config reload failed, keeping generation %d: %v", r.generation, err)
+		return fmt.Errorf("config reload failed: %w", err)
+	}
+
+	if cfg.Server.Port != r.cfg.Server.Port {
+		log.Printf("Config reload: server.port changed to %q, restart required to take effect", cfg.Server.Port)
+	}
+	if cfg.Server.WatchConfig != r.cfg.Server.WatchConfig {
+		if cfg.Server.WatchConfig {
+			log.Printf("Config reload: server.watch_config enabled, watching %s for changes", r.configPath)
+		} else {
+			log.Printf("Config reload: server.watch_config disabled, no longer watching %s", r.configPath)
+		}
+	}
+
+	if r.scheduler != nil {
+		r.scheduler.stop()
+		r.scheduler = nil
+	}
+	r.activate(cfg)
+	log.Printf("Config reloaded from %s: generation %d, %d checks", r.configPath, r.generation, len(cfg.Checks))
+	return nil
+}
+
+// activate makes cfg the next generation. Callers must hold r.mu.
+func (r *configReloader) activate(cfg *Config) {
+	r.generation++
+	cfg.generation = r.generation
+	cfg.loadedAt = time.Now()
+
+	r.store.retain(cfg.Checks)
+	r.activateNotifications(cfg)
+	if cfg.Server.CheckInterval > 0 {
+		r.scheduler = newScheduler(cfg, r.store)
+		r.scheduler.start()
+	}
+
+	// The watcher keeps running across reloads, so it keeps its record
+	// of the files and only reloads again on the next change.
+	switch {
+	case cfg.Server.WatchConfig && r.watchStop == nil:
+		r.watchStop = make(chan struct{})
+		go r.watchFile(r.watchStop)
+	case !cfg.Server.WatchConfig && r.watchStop != nil:
+		close(r.watchStop)
+		r.watchStop = nil
+	}
+
+	r.cfg = cfg
+	r.handler.Store(newServeMux(cfg, r.store))
+}
+
+// activateNotifications replaces the notifiers with those configured in cfg.
+// The new notifiers learn which checks are already failing, and
+// notifications already queued for the previous notifiers are still
+// delivered. Callers must hold r.mu.
+func (r *configReloader) activateNotifications(cfg *Config) {
+	d, err := newDispatcher(cfg.Notifications)
+	if err != nil {
+		// Notifier configs are validated on load, so this is unexpected.
+		log.Printf("Notifications disabled: %v", err)
+	}
+
+	var notify func(StateChange)
+	if d != nil {
+		d.start(r.store.failing())
+		notify = d.notify
+	}
+	r.store.setNotify(notify)
+
+	if r.dispatcher != nil {
+		r.dispatcher.stop()
+	}
+	r.dispatcher = d
+}
+
+func (r *configReloader) handleSignals(signals chan os.Signal) {
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-signals:
+			log.Printf("Received SIGHUP, reloading configuration")
+			_ = r.reload()
+		}
+	}
+}
+
+// watchFile polls the config file and its included files and reloads when
+// a file is added or removed or its size or modification time changes.
+// Polling also catches files replaced through symlinks, as done for
+// Kubernetes ConfigMaps. It runs until stop is closed or the reloader stops.
+func (r *configReloader) watchFile(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.watchInterval)
+	defer ticker.Stop()
+
+	last := r.configFingerprint()
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := os.Stat(r.configPath); err != nil {
+				continue
+			}
+			current := r.configFingerprint()
+			if current == last {
+				continue
+			}
+			last = current
+			log.Printf("Config file %s or its includes changed, reloading configuration", r.configPath)
+			_ = r.reload()
+		}
+	}
+}
+
+// configFingerprint summarizes the name, size and modification time of the
+// config file and the files currently matched by its include patterns.
+func (r *configReloader) configFingerprint() string {
+	files := []string{r.configPath}
+	if included, err := includedFiles(r.configPath, r.config().Include); err == nil {
+		files = append(files, included...)
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s|%d|%d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeTestConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+}
+
+// healthFromReloader requests /health through the reloader's active handlers.
+func healthFromReloader(t *testing.T, r *configReloader) HealthStatus {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var status HealthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return status
+}
+
+const reloadConfigV1 = `
+server:
+  timeout: 200ms
+checks:
+  - host: "127.0.0.1"
+    port: 1
+    name: "First"
+`
+
+const reloadConfigV2 = `
+server:
+  timeout: 200ms
+checks:
+  - host: "127.0.0.1"
+    port: 1
+    name: "First"
+  - host: "127.0.0.1"
+    port: 2
+    name: "Second"
+`
+
+func TestConfigReloaderReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, reloadConfigV1)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.start()
+	defer reloader.stop()
+
+	status := healthFromReloader(t, reloader)
+	if status.ConfigGeneration != 1 {
+		t.Errorf("ConfigGeneration = %d, want 1", status.ConfigGeneration)
+	}
+	if status.ConfigLoadedAt == "" {
+		t.Error("ConfigLoadedAt should be set")
+	}
+	if len(status.Checks) != 1 {
+		t.Errorf("Number of checks = %d, want 1", len(status.Checks))
+	}
+
+	writeTestConfig(t, configPath, reloadConfigV2)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+
+	status = healthFromReloader(t, reloader)
+	if status.ConfigGeneration != 2 {
+		t.Errorf("ConfigGeneration = %d, want 2", status.ConfigGeneration)
+	}
+	if len(status.Checks) != 2 {
+		t.Errorf("Number of checks = %d, want 2", len(status.Checks))
+	}
+}
+
+func TestConfigReloaderKeepsConfigOnError(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, reloadConfigV1)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.start()
+	defer reloader.stop()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "invalid YAML",
+			data:    "checks: [unterminated",
+			wantErr: "failed to parse config file",
+		},
+		{
+			name:    "no checks",
+			data:    "checks: []",
+			wantErr: "no port checks configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestConfig(t, configPath, tt.data)
+
+			err := reloader.reload()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("reload() error = %v, want error containing %q", err, tt.wantErr)
+			}
+
+			if reloader.config() != cfg {
+				t.Error("Active config should not change after a failed reload")
+			}
+			status := healthFromReloader(t, reloader)
+			if status.ConfigGeneration != 1 || len(status.Checks) != 1 {
+				t.Errorf("Generation %d with %d checks, want generation 1 with 1 check", status.ConfigGeneration, len(status.Checks))
+			}
+		})
+	}
+}
+
+func TestConfigReloaderSIGHUP(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, reloadConfigV1)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.mu.Lock()
+	reloader.activate(cfg)
+	reloader.mu.Unlock()
+	defer reloader.stop()
+
+	signals := make(chan os.Signal, 1)
+	go reloader.handleSignals(signals)
+
+	writeTestConfig(t, configPath, reloadConfigV2)
+	signals <- syscall.SIGHUP
+
+	waitForGeneration(t, reloader, 2)
+}
+
+func TestConfigReloaderWatchFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, strings.Replace(reloadConfigV1, "server:\n", "server:\n  watch_config: true\n", 1))
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.watchInterval = 10 * time.Millisecond
+	reloader.start()
+	defer reloader.stop()
+
+	// Let the watcher record the initial state before changing the file
+	time.Sleep(50 * time.Millisecond)
+	writeTestConfig(t, configPath, reloadConfigV2)
+
+	waitForGeneration(t, reloader, 2)
+}
+
+func TestConfigReloaderWatchIncludes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	writeTestConfig(t, configPath, strings.Replace(reloadConfigV1, "server:\n", "include: [\"conf.d/*.yaml\"]\nserver:\n  watch_config: true\n", 1))
+	if err := os.Mkdir(filepath.Join(tmpDir, "conf.d"), 0755); err != nil {
+		t.Fatalf("Failed to create include directory: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.watchInterval = 10 * time.Millisecond
+	reloader.start()
+	defer reloader.stop()
+
+	// A new fragment in the include directory triggers a reload
+	time.Sleep(50 * time.Millisecond)
+	writeTestConfig(t, filepath.Join(tmpDir, "conf.d", "team.yaml"), "checks:\n  - host: \"127.0.0.1\"\n    port: 2\n    name: \"Team\"\n")
+
+	waitForGeneration(t, reloader, 2)
+	if got := len(reloader.config().Checks); got != 2 {
+		t.Errorf("Checks after reload = %d, want 2", got)
+	}
+}
+
+func TestConfigReloaderWatchConfigReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, reloadConfigV1)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.watchInterval = 10 * time.Millisecond
+	reloader.start()
+	defer reloader.stop()
+
+	if reloader.watchStop != nil {
+		t.Fatal("Watcher should not run without watch_config")
+	}
+
+	// A reload that enables watch_config starts the watcher
+	writeTestConfig(t, configPath, strings.Replace(reloadConfigV1, "server:\n", "server:\n  watch_config: true\n", 1))
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	writeTestConfig(t, configPath, reloadConfigV2)
+	waitForGeneration(t, reloader, 3)
+
+	// A reload that disables it stops the watcher again
+	writeTestConfig(t, configPath, reloadConfigV1)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+	reloader.mu.Lock()
+	watching := reloader.watchStop != nil
+	reloader.mu.Unlock()
+	if watching {
+		t.Fatal("Watcher should stop when watch_config is removed")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	generation := reloader.config().generation
+	writeTestConfig(t, configPath, reloadConfigV2)
+	time.Sleep(100 * time.Millisecond)
+	if got := reloader.config().generation; got != generation {
+		t.Errorf("Generation = %d after a file change without watch_config, want %d", got, generation)
+	}
+}
+
+func TestConfigReloaderRestartsScheduler(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, strings.Replace(reloadConfigV1, "server:\n", "server:\n  check_interval: 1h\n", 1))
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.start()
+	defer reloader.stop()
+
+	first := reloader.scheduler
+	if first == nil {
+		t.Fatal("Expected scheduler for check_interval")
+	}
+
+	writeTestConfig(t, configPath, reloadConfigV2)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+
+	if reloader.scheduler != nil {
+		t.Error("Scheduler should stop when check_interval is removed")
+	}
+	if first.ctx.Err() == nil {
+		t.Error("Previous scheduler should be stopped")
+	}
+}
+
+func TestConfigReloaderNotifications(t *testing.T) {
+	changes := make(chan StateChange, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var change StateChange
+		_ = json.NewDecoder(r.Body).Decode(&change)
+		changes <- change
+	}))
+	defer server.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, configPath, strings.Replace(reloadConfigV1, "server:\n", "server:\n  check_interval: 1h\n", 1)+`
+notifications:
+  notifiers:
+    - name: "hook"
+      type: webhook
+      webhook:
+        url: "`+server.URL+`"
+`)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.start()
+	defer reloader.stop()
+
+	select {
+	case change := <-changes:
+		if change.Name != "First" || change.OldStatus != "unknown" || change.NewStatus != "unhealthy" {
+			t.Errorf("Change = %+v, want First unknown -> unhealthy", change)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the webhook")
+	}
+
+	writeTestConfig(t, configPath, reloadConfigV1)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+	if reloader.dispatcher != nil {
+		t.Error("Dispatcher should stop when notifiers are removed")
+	}
+}
+
+func waitForGeneration(t *testing.T, r *configReloader, generation int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if r.config().generation == generation {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Config generation = %d, want %d", r.config().generation, generation)
+}
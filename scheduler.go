@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// resultStore keeps the latest result of every check along with the
+// metrics accumulated from all recorded results.
+// It is safe for concurrent use by the scheduler and HTTP handlers.
+// Changes of a stored status are passed to notify, if set.
+type resultStore struct {
+	mu      sync.RWMutex
+	results map[string]PortCheckResult
+	metrics *checkMetrics
+	notify  func(StateChange)
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{
+		results: make(map[string]PortCheckResult),
+		metrics: newCheckMetrics(),
+	}
+}
+
+// checkKey identifies a check in the result store.
+func checkKey(portCheck PortCheck) string {
+	return fmt.Sprintf("%s|%s:%d", portCheck.Name, portCheck.Host, portCheck.Port)
+}
+
+// set records a new result of portCheck and returns it as stored, with the
+// status smoothed by the check's failure and success thresholds. Metrics
+// count the result before smoothing.
+func (s *resultStore) set(portCheck PortCheck, result PortCheckResult) PortCheckResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := checkKey(portCheck)
+	s.metrics.observe(key, result)
+
+	var previous *PortCheckResult
+	if stored, ok := s.results[key]; ok {
+		previous = &stored
+	}
+	result = applyThresholds(portCheck, previous, result, time.Now())
+	s.results[key] = result
+
+	if s.notify != nil {
+		if change, ok := newStateChange(previous, result); ok {
+			change.FailingChecks = s.failingChecks()
+			s.notify(change)
+		}
+	}
+	return result
+}
+
+// failing returns the change from "unknown" for every stored result that is
+// not healthy, in no particular order.
+func (s *resultStore) failing() []StateChange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []StateChange
+	failing := s.failingChecks()
+	for _, result := range s.results {
+		if change, ok := newStateChange(nil, result); ok {
+			change.FailingChecks = failing
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// failingChecks returns the sorted names of the stored checks that are not
+// healthy. Callers must hold s.mu for reading.
+func (s *resultStore) failingChecks() []string {
+	var names []string
+	for _, result := range s.results {
+		if result.Status != "healthy" {
+			names = append(names, result.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setNotify sets the function that is told about status changes. Once it
+// returns, the previous function is no longer called.
+func (s *resultStore) setNotify(notify func(StateChange)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify = notify
+}
+
+func (s *resultStore) get(portCheck PortCheck) (PortCheckResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.results[checkKey(portCheck)]
+	return result, ok
+}
+
+// retain drops results and metrics of checks that are no longer configured.
+// Each dropped check that was not healthy is reported as "removed", so that
+// notifiers resolve the incidents and alerts it opened.
+func (s *resultStore) retain(checks []PortCheck) {
+	keep := make(map[string]bool, len(checks))
+	for _, portCheck := range checks {
+		keep[checkKey(portCheck)] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []PortCheckResult
+	for key, result := range s.results {
+		if !keep[key] {
+			delete(s.results, key)
+			if result.Status != "healthy" {
+				removed = append(removed, result)
+			}
+		}
+	}
+	if s.notify != nil && len(removed) > 0 {
+		sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+		failing := s.failingChecks()
+		now := time.Now().Format(time.RFC3339)
+		for _, previous := range removed {
+			result := previous
+			result.Status = "removed"
+			result.Error = ""
+			result.Warning = ""
+			result.LastStateChange = now
+			if change, ok := newStateChange(&previous, result); ok {
+				change.FailingChecks = failing
+				s.notify(change)
+			}
+		}
+	}
+	for key := range s.metrics.results {
+		if !keep[key] {
+			delete(s.metrics.results, key)
+			delete(s.metrics.latencies, key)
+		}
+	}
+}
+
+// update stores results produced for checks, which must have the same order,
+// and returns them as stored.
+func (s *resultStore) update(checks []PortCheck, results []PortCheckResult) []PortCheckResult {
+	stored := make([]PortCheckResult, len(results))
+	for i, portCheck := range checks {
+		stored[i] = s.set(portCheck, results[i])
+	}
+	return stored
+}
+
+// applyThresholds derives the reported status of result from the previous
+// stored result of portCheck. Like Kubernetes probes, a healthy check only
+// becomes unhealthy after failure_threshold consecutive failures and
+// recovers after success_threshold consecutive successes. The first result
+// of a check is taken as is.
+func applyThresholds(portCheck PortCheck, previous *PortCheckResult, result PortCheckResult, now time.Time) PortCheckResult {
+	healthy := result.Status == "healthy"
+	if healthy {
+		result.ConsecutiveSuccesses = 1
+	} else {
+		result.ConsecutiveFailures = 1
+	}
+
+	if previous == nil {
+		result.LastStateChange = now.Format(time.RFC3339)
+		return result
+	}
+
+	if healthy {
+		result.ConsecutiveSuccesses += previous.ConsecutiveSuccesses
+	} else {
+		result.ConsecutiveFailures += previous.ConsecutiveFailures
+	}
+	result.LastStateChange = previous.LastStateChange
+
+	switch {
+	case previous.Status == "healthy" && !healthy && result.ConsecutiveFailures < threshold(portCheck.FailureThreshold):
+		// Not enough failures yet: keep reporting healthy, with the error.
+		result.Status = previous.Status
+	case previous.Status != "healthy" && healthy && result.ConsecutiveSuccesses < threshold(portCheck.SuccessThreshold):
+		result.Status = previous.Status
+		result.Error = fmt.Sprintf("recovering: %d of %d consecutive successes", result.ConsecutiveSuccesses, threshold(portCheck.SuccessThreshold))
+	case previous.Status != result.Status:
+		result.LastStateChange = now.Format(time.RFC3339)
+	}
+	return result
+}
+
+// threshold returns a configured failure or success threshold, defaulting to 1.
+func threshold(configured int) int {
+	if configured < 1 {
+		return 1
+	}
+	return configured
+}
+
+// cachedHealthCheck builds the health status from stored results instead of
+// dialing every check. Checks without a stored result are reported as unhealthy.
+func cachedHealthCheck(cfg *Config, store *resultStore) HealthStatus {
+	results := make([]PortCheckResult, 0, len(cfg.Checks))
+	for _, portCheck := range cfg.Checks {
+		result, ok := store.get(portCheck)
+		if !ok {
+			result = newResult(portCheck)
+			result.Status = "unhealthy"
+			result.Error = "no result yet"
+		}
+		// Configured fields may have changed by a reload since the check ran.
+		result.Source = portCheck.Source
+		result.Severity = checkSeverity(portCheck)
+		result.Groups = portCheck.Groups
+		result.Tags = portCheck.Tags
+		results = append(results, result)
+	}
+	return buildHealthStatus(results)
+}
+
+// scheduler runs every check in the background on its own interval and
+// records the results in a resultStore.
+type scheduler struct {
+	cfg    *Config
+	store  *resultStore
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newScheduler(cfg *Config, store *resultStore) *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		cfg:    cfg,
+		store:  store,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// checkInterval returns how often portCheck is run in the background.
+func (s *scheduler) checkInterval(portCheck PortCheck) time.Duration {
+	if portCheck.Interval > 0 {
+		return portCheck.Interval
+	}
+	return s.cfg.Server.CheckInterval
+}
+
+// start runs an initial round synchronously, so the store is populated before
+// the first request is served, then keeps checking in the background.
+func (s *scheduler) start() {
+	s.store.update(s.cfg.Checks, runChecks(s.ctx, s.cfg, s.cfg.Checks))
+
+	for _, portCheck := range s.cfg.Checks {
+		s.wg.Add(1)
+		go s.loop(portCheck, s.checkInterval(portCheck))
+	}
+}
+
+// stop terminates all background loops and waits for them to return.
+func (s *scheduler) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *scheduler) loop(portCheck PortCheck, interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			result := runCheck(s.ctx, s.cfg, portCheck)
+			if s.ctx.Err() != nil {
+				return
+			}
+			previous, ok := s.store.get(portCheck)
+			result = s.store.set(portCheck, result)
+			if ok && previous.Status != result.Status {
+				log.Printf("Check %q (%s:%d) changed from %s to %s", portCheck.Name, portCheck.Host, portCheck.Port, previous.Status, result.Status)
+			}
+		}
+	}
+}
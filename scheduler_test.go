@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResultStore(t *testing.T) {
+	store := newResultStore()
+	check := PortCheck{Host: "127.0.0.1", Port: 25, Name: "SMTP"}
+
+	if _, ok := store.get(check); ok {
+		t.Error("Expected no result for unknown check")
+	}
+
+	store.set(check, PortCheckResult{Name: "SMTP", Status: "healthy"})
+
+	result, ok := store.get(check)
+	if !ok {
+		t.Fatal("Expected stored result")
+	}
+	if result.Status != "healthy" {
+		t.Errorf("Status = %q, want 'healthy'", result.Status)
+	}
+
+	// Same name on another port is a different check
+	other := PortCheck{Host: "127.0.0.1", Port: 587, Name: "SMTP"}
+	if _, ok := store.get(other); ok {
+		t.Error("Expected checks with different ports to be stored separately")
+	}
+}
+
+func TestCachedHealthCheck(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{CheckInterval: time.Minute},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: 25, Name: "SMTP"},
+			{Host: "127.0.0.1", Port: 143, Name: "IMAP"},
+		},
+	}
+
+	store := newResultStore()
+	store.set(cfg.Checks[0], PortCheckResult{Name: "SMTP", Host: "127.0.0.1", Port: 25, Status: "healthy", CheckedAt: "2025-01-01T00:00:00Z"})
+
+	status := cachedHealthCheck(cfg, store)
+
+	if status.Status != "unhealthy" {
+		t.Errorf("Status = %q, want 'unhealthy'", status.Status)
+	}
+	if len(status.Checks) != 2 {
+		t.Fatalf("Expected 2 check results, got %d", len(status.Checks))
+	}
+	if status.Checks[0].CheckedAt != "2025-01-01T00:00:00Z" {
+		t.Errorf("CheckedAt = %q, want cached timestamp", status.Checks[0].CheckedAt)
+	}
+	if status.Checks[1].Error != "no result yet" {
+		t.Errorf("Error = %q, want 'no result yet'", status.Checks[1].Error)
+	}
+
+	store.set(cfg.Checks[1], PortCheckResult{Name: "IMAP", Host: "127.0.0.1", Port: 143, Status: "healthy"})
+
+	status = cachedHealthCheck(cfg, store)
+	if status.Status != "healthy" {
+		t.Errorf("Status = %q, want 'healthy'", status.Status)
+	}
+}
+
+func TestSchedulerRunsChecksInBackground(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+
+	var testPort int
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	_, _ = fmt.Sscanf(portStr, "%d", &testPort)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Timeout:       500 * time.Millisecond,
+			CheckInterval: time.Hour,
+		},
+		Checks: []PortCheck{
+			{Host: "127.0.0.1", Port: testPort, Name: "Test Service", Interval: 20 * time.Millisecond},
+		},
+	}
+
+	store := newResultStore()
+	sched := newScheduler(cfg, store)
+	sched.start()
+	defer sched.stop()
+
+	// The initial round runs synchronously
+	result, ok := store.get(cfg.Checks[0])
+	if !ok {
+		t.Fatal("Expected result after start")
+	}
+	if result.Status != "healthy" {
+		t.Errorf("Status = %q, want 'healthy'", result.Status)
+	}
+
+	// Closing the listener should be picked up by the per-check interval
+	_ = listener.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if result, _ := store.get(cfg.Checks[0]); result.Status == "unhealthy" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Scheduler did not record the failed check")
+}
+
+func TestSchedulerCheckInterval(t *testing.T) {
+	cfg := &Config{Server: ServerConfig{CheckInterval: 30 * time.Second}}
+	sched := newScheduler(cfg, newResultStore())
+
+	if got := sched.checkInterval(PortCheck{}); got != 30*time.Second {
+		t.Errorf("checkInterval() = %v, want 30s", got)
+	}
+	if got := sched.checkInterval(PortCheck{Interval: 5 * time.Second}); got != 5*time.Second {
+		t.Errorf("checkInterval() = %v, want 5s", got)
+	}
+}
+
+func TestResultStoreThresholds(t *testing.T) {
+	check := PortCheck{Host: "127.0.0.1", Port: 25, Name: "SMTP", FailureThreshold: 3, SuccessThreshold: 2}
+
+	steps := []struct {
+		observed      string
+		wantStatus    string
+		wantFailures  int
+		wantSuccesses int
+		wantChange    bool
+	}{
+		{"healthy", "healthy", 0, 1, true},
+		{"unhealthy", "healthy", 1, 0, false},
+		{"unhealthy", "healthy", 2, 0, false},
+		{"healthy", "healthy", 0, 1, false},
+		{"unhealthy", "healthy", 1, 0, false},
+		{"unhealthy", "healthy", 2, 0, false},
+		{"unhealthy", "unhealthy", 3, 0, true},
+		{"unhealthy", "unhealthy", 4, 0, false},
+		{"healthy", "unhealthy", 0, 1, false},
+		{"healthy", "healthy", 0, 2, true},
+	}
+
+	store := newResultStore()
+	lastChange := ""
+	for i, step := range steps {
+		// Make every state change produce a distinct timestamp
+		store.mu.Lock()
+		if stored, ok := store.results[checkKey(check)]; ok {
+			stored.LastStateChange = fmt.Sprintf("step %d", i)
+			store.results[checkKey(check)] = stored
+			lastChange = stored.LastStateChange
+		}
+		store.mu.Unlock()
+
+		result := store.set(check, PortCheckResult{Name: "SMTP", Status: step.observed})
+		if result.Status != step.wantStatus {
+			t.Errorf("Step %d: Status = %q, want %q", i, result.Status, step.wantStatus)
+		}
+		if result.ConsecutiveFailures != step.wantFailures || result.ConsecutiveSuccesses != step.wantSuccesses {
+			t.Errorf("Step %d: consecutive failures/successes = %d/%d, want %d/%d",
+				i, result.ConsecutiveFailures, result.ConsecutiveSuccesses, step.wantFailures, step.wantSuccesses)
+		}
+		if changed := result.LastStateChange != lastChange; changed != step.wantChange {
+			t.Errorf("Step %d: LastStateChange = %q (was %q), want change %v", i, result.LastStateChange, lastChange, step.wantChange)
+		}
+		if stored, _ := store.get(check); stored.Status != result.Status {
+			t.Errorf("Step %d: stored Status = %q, want %q", i, stored.Status, result.Status)
+		}
+	}
+}
+
+func TestResultStoreThresholdsRecovering(t *testing.T) {
+	store := newResultStore()
+	check := PortCheck{Host: "127.0.0.1", Port: 25, Name: "SMTP", SuccessThreshold: 2}
+
+	store.set(check, PortCheckResult{Status: "unhealthy", Error: "connection refused"})
+	result := store.set(check, PortCheckResult{Status: "healthy"})
+	if result.Status != "unhealthy" {
+		t.Fatalf("Status = %q, want 'unhealthy'", result.Status)
+	}
+	if result.Error != "recovering: 1 of 2 consecutive successes" {
+		t.Errorf("Error = %q, want recovery progress", result.Error)
+	}
+}
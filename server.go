@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 )
 
 // serverStarter is a function type that starts the HTTP server
@@ -12,6 +13,10 @@ type serverStarter func(addr string, handler http.Handler) error
 
 // run is the main application logic, separated from main() for testability
 func run(args []string, exit func(int), startServer serverStarter) error {
+	if len(args) > 0 && args[0] == "validate" {
+		return runValidate(args[1:], exit)
+	}
+
 	fs := flag.NewFlagSet("portguard", flag.ContinueOnError)
 	configPath := fs.String("config", defaultConfigPath, "Path to configuration file")
 	showVersion := fs.Bool("version", false, "Show version and exit")
@@ -38,34 +43,83 @@ func run(args []string, exit func(int), startServer serverStarter) error {
 	return setupAndStartServer(cfg, *configPath, startServer)
 }
 
+// runValidate implements "portguard validate": it loads the config file,
+// reports every problem found and exits non-zero if there are any.
+func runValidate(args []string, exit func(int)) error {
+	fs := flag.NewFlagSet("portguard validate", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to configuration file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err == nil && len(cfg.Checks) == 0 {
+		err = fmt.Errorf("no port checks configured")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		exit(1)
+		return nil
+	}
+
+	fmt.Printf("%s: OK (%d checks)\n", *configPath, len(cfg.Checks))
+	exit(0)
+	return nil
+}
+
 // setupAndStartServer configures HTTP handlers and starts the server
 func setupAndStartServer(cfg *Config, configPath string, startServer serverStarter) error {
-	// Create a new ServeMux for this server instance
-	mux := http.NewServeMux()
-	
-	// Wrap handlers with authentication middleware
-	mux.HandleFunc("/health", basicAuthMiddleware(cfg, healthHandler(cfg)))
-	mux.HandleFunc("/live", basicAuthMiddleware(cfg, liveHandler))
-	mux.HandleFunc("/", basicAuthMiddleware(cfg, rootHandler(cfg)))
+	reloader := newConfigReloader(cfg, configPath)
+	reloader.start()
 
 	listenAddr := ":" + cfg.Server.Port
 
 	log.Printf("PortGuard v%s starting...", appVersion)
 	log.Printf("Configuration loaded from: %s", configPath)
 	log.Printf("Monitoring %d ports with %s timeout", len(cfg.Checks), cfg.Server.Timeout)
+	if cfg.Server.CheckInterval > 0 {
+		log.Printf("Background checks: ENABLED (every %s, /health serves cached results)", cfg.Server.CheckInterval)
+	}
 	if cfg.Server.Auth.Enabled && cfg.Server.Auth.Username != "" && cfg.Server.Auth.Password != "" {
 		log.Printf("HTTP Basic Authentication: ENABLED (username: %s)", cfg.Server.Auth.Username)
 	} else {
 		log.Printf("HTTP Basic Authentication: DISABLED")
 	}
+	if n := len(cfg.Notifications.Notifiers); n > 0 {
+		log.Printf("Notifications: ENABLED (%d notifiers)", n)
+	}
+	if cfg.Server.WatchConfig {
+		log.Printf("Config reload: on SIGHUP and when %s changes", configPath)
+	} else {
+		log.Printf("Config reload: on SIGHUP")
+	}
 	log.Printf("HTTP server listening on %s", listenAddr)
 	log.Printf("Endpoints:")
 	log.Printf("  - http://localhost%s/health (detailed JSON status)", listenAddr)
 	log.Printf("  - http://localhost%s/live (simple OK response)", listenAddr)
+	log.Printf("  - http://localhost%s/metrics (Prometheus metrics)", listenAddr)
 
-	if err := startServer(listenAddr, mux); err != nil {
+	if err := startServer(listenAddr, reloader); err != nil {
 		return fmt.Errorf("server error: %w", err)
 	}
 
 	return nil
 }
+
+// newServeMux creates the HTTP handlers for cfg.
+// Every config generation gets its own ServeMux.
+func newServeMux(cfg *Config, store *resultStore) *http.ServeMux {
+	// Create a new ServeMux for this server instance
+	mux := http.NewServeMux()
+
+	// Wrap handlers with authentication middleware
+	mux.HandleFunc("/health", basicAuthMiddleware(cfg, healthHandler(cfg, store)))
+	mux.HandleFunc("/health/group/{name}", basicAuthMiddleware(cfg, groupHealthHandler(cfg, store)))
+	mux.HandleFunc("/health/check/{name}", basicAuthMiddleware(cfg, checkHealthHandler(cfg, store)))
+	mux.HandleFunc("/live", basicAuthMiddleware(cfg, liveHandler))
+	mux.HandleFunc("/metrics", basicAuthMiddleware(cfg, metricsHandler(cfg, store)))
+	mux.HandleFunc("/", basicAuthMiddleware(cfg, rootHandler(cfg)))
+
+	return mux
+}
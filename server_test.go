@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mockExit is a test helper that captures exit codes
@@ -348,3 +350,94 @@ checks:
 		t.Errorf("Expected 'server error', got: %v", err)
 	}
 }
+
+func TestSetupAndStartServerMetricsEndpoint(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{
+			Port:    "7070",
+			Timeout: time.Second,
+			Auth: AuthConfig{
+				Enabled:  true,
+				Username: "admin",
+				Password: "secret",
+			},
+		},
+		Checks: []PortCheck{{Host: "127.0.0.1", Port: 1, Name: "Closed"}},
+	}
+
+	mockServer := &mockServerStarter{}
+	if err := setupAndStartServer(cfg, "test-config.yaml", mockServer.start); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	mockServer.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Without credentials: status code = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	mockServer.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("With credentials: status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "portguard_build_info") {
+		t.Error("Expected Prometheus metrics in response")
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		configData   string
+		wantExitCode int
+	}{
+		{
+			name: "valid config",
+			configData: `checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+`,
+			wantExitCode: 0,
+		},
+		{
+			name: "invalid config",
+			configData: `checks:
+  - host: "localhost"
+    port: 0
+    name: "SSH"
+`,
+			wantExitCode: 1,
+		},
+		{
+			name:         "no checks",
+			configData:   "checks: []\n",
+			wantExitCode: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.configData), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			mockExit := &mockExit{}
+			mockServer := &mockServerStarter{}
+			if err := run([]string{"validate", "--config", configPath}, mockExit.exit, mockServer.start); err != nil {
+				t.Fatalf("run() returned error: %v", err)
+			}
+
+			if !mockExit.called || mockExit.exitCode != tt.wantExitCode {
+				t.Errorf("exit called = %v with code %d, want code %d", mockExit.called, mockExit.exitCode, tt.wantExitCode)
+			}
+			if mockServer.called {
+				t.Error("Server should not be started by validate")
+			}
+		})
+	}
+}
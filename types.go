@@ -4,57 +4,364 @@ import "time"
 
 // Config represents the main configuration structure for PortGuard.
 // It contains server settings and a list of ports to check.
+// Include lists glob patterns of fragment files that contribute more checks.
+// Notifications configures alerts sent when a check changes state.
+// The generation and load time are set when the config is activated.
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	Checks []PortCheck  `yaml:"checks"`
+	Server        ServerConfig        `yaml:"server"`
+	Checks        []PortCheck         `yaml:"checks"`
+	Include       []string            `yaml:"include,omitempty"`
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+
+	generation int
+	loadedAt   time.Time
+}
+
+// ConfigFragment is a file pulled in through Config.Include.
+// Fragments can only contribute checks.
+type ConfigFragment struct {
+	Checks []PortCheck `yaml:"checks"`
 }
 
 // ServerConfig holds the HTTP server configuration.
 // Port specifies which port the HTTP server listens on.
 // Timeout sets the maximum duration for port check operations.
+// MaxConcurrency limits how many checks run in parallel.
+// Deadline bounds the total duration of a health check round (0 disables it).
+// CheckInterval enables background checking; /health then serves cached results.
+// WatchConfig reloads the config when the file changes, in addition to SIGHUP.
+// DegradedStatusCode is the /health response code for a degraded status (default 200).
 // Auth contains optional HTTP Basic Authentication settings.
 type ServerConfig struct {
-	Port    string        `yaml:"port"`
-	Timeout time.Duration `yaml:"timeout"`
-	Auth    AuthConfig    `yaml:"auth,omitempty"`
+	Port               string        `yaml:"port"`
+	Timeout            time.Duration `yaml:"timeout"`
+	MaxConcurrency     int           `yaml:"max_concurrency,omitempty"`
+	Deadline           time.Duration `yaml:"deadline,omitempty"`
+	CheckInterval      time.Duration `yaml:"check_interval,omitempty"`
+	WatchConfig        bool          `yaml:"watch_config,omitempty"`
+	DegradedStatusCode int           `yaml:"degraded_status_code,omitempty"`
+	Auth               AuthConfig    `yaml:"auth,omitempty"`
 }
 
 // AuthConfig holds HTTP Basic Authentication configuration.
 // When both Username and Password are empty, authentication is disabled.
+// PasswordFile reads the password from a file, such as a mounted secret.
 type AuthConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Enabled      bool   `yaml:"enabled"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// NotificationsConfig configures the notifiers that are told about check
+// state changes. BaseURL is the external URL of this PortGuard instance,
+// used to link notifications to the check's /health/check endpoint.
+// DeadLetterFile receives notifications that could not be delivered after
+// all attempts, one JSON object per line; without it they are only logged.
+type NotificationsConfig struct {
+	BaseURL        string           `yaml:"base_url,omitempty"`
+	DeadLetterFile string           `yaml:"dead_letter_file,omitempty"`
+	Notifiers      []NotifierConfig `yaml:"notifiers,omitempty"`
+}
+
+// NotifierConfig defines a single notification target.
+// Type selects the target: "webhook", "slack", "mattermost", "teams", "smtp",
+// "pagerduty", "alertmanager" or "exec", configured by the matching block.
+// Timeout bounds each delivery attempt (default 10s). A failed delivery is
+// attempted up to Attempts times (default 3), waiting RetryBackoff (default
+// 1s) before the first retry and twice as long before each next one.
+// BatchWindow collects the changes that follow the first one for that long
+// and delivers them together; only smtp notifiers support it.
+type NotifierConfig struct {
+	Name         string                `yaml:"name"`
+	Type         string                `yaml:"type"`
+	Timeout      time.Duration         `yaml:"timeout,omitempty"`
+	Attempts     int                   `yaml:"attempts,omitempty"`
+	RetryBackoff time.Duration         `yaml:"retry_backoff,omitempty"`
+	BatchWindow  time.Duration         `yaml:"batch_window,omitempty"`
+	Webhook      *WebhookNotifier      `yaml:"webhook,omitempty"`
+	Slack        *ChatNotifier         `yaml:"slack,omitempty"`
+	Mattermost   *ChatNotifier         `yaml:"mattermost,omitempty"`
+	Teams        *ChatNotifier         `yaml:"teams,omitempty"`
+	SMTP         *SMTPNotifier         `yaml:"smtp,omitempty"`
+	PagerDuty    *EventsNotifier       `yaml:"pagerduty,omitempty"`
+	Alertmanager *AlertmanagerNotifier `yaml:"alertmanager,omitempty"`
+	Exec         *ExecNotifier         `yaml:"exec,omitempty"`
+}
+
+// WebhookNotifier sends every state change as an HTTP request to URL
+// (type: webhook). Method defaults to POST. Without a Template the body is
+// the StateChange as JSON; otherwise Template is a Go text/template executed
+// with the StateChange, where {{json .Field}} writes a JSON encoded value.
+type WebhookNotifier struct {
+	URL      string            `yaml:"url"`
+	Method   string            `yaml:"method,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Template string            `yaml:"template,omitempty"`
 }
 
 // PortCheck defines a single port to monitor.
 // It includes the target host, port number, and descriptive information.
 // An optional Timeout can be specified per check, otherwise the server timeout is used.
+// Interval overrides server.check_interval when background checking is enabled.
+// Severity is "critical" (default), "warning" or "info"; see buildHealthStatus.
+// Groups select the /health/group/{name} endpoints a check belongs to, and
+// Tags can filter /health with ?tag=.
+// FailureThreshold and SuccessThreshold (default 1) are the numbers of
+// consecutive results needed before a check flips to unhealthy or back.
+// Attempts (default 1) retries a failing check within one run, waiting
+// RetryBackoff before the first retry and twice as long before each next one.
+// A successful check slower than WarnLatency is degraded, one slower than
+// MaxLatency fails.
+// Type selects how the check is performed: "tcp" (default), "http", "tls" or "dns".
+// For TCP checks, Send is written after connecting and Expect is a regular
+// expression the response must match before the timeout. Without Expect, a
+// check with Send still requires some response.
+// Protocol "udp" sends Send (or the hex encoded SendHex) as a datagram and
+// requires a reply, unless BestEffort is set.
 type PortCheck struct {
-	Host        string        `yaml:"host" json:"host"`
-	Port        int           `yaml:"port" json:"port"`
-	Name        string        `yaml:"name" json:"name"`
-	Description string        `yaml:"description" json:"description"`
-	Timeout     time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Host             string        `yaml:"host" json:"host"`
+	Port             int           `yaml:"port" json:"port"`
+	Name             string        `yaml:"name" json:"name"`
+	Description      string        `yaml:"description" json:"description"`
+	Severity         string        `yaml:"severity,omitempty" json:"severity,omitempty"`
+	Groups           []string      `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Tags             []string      `yaml:"tags,omitempty" json:"tags,omitempty"`
+	FailureThreshold int           `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"`
+	SuccessThreshold int           `yaml:"success_threshold,omitempty" json:"success_threshold,omitempty"`
+	Attempts         int           `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	RetryBackoff     time.Duration `yaml:"retry_backoff,omitempty" json:"retry_backoff,omitempty"`
+	WarnLatency      time.Duration `yaml:"warn_latency,omitempty" json:"warn_latency,omitempty"`
+	MaxLatency       time.Duration `yaml:"max_latency,omitempty" json:"max_latency,omitempty"`
+	Timeout          time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Interval         time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Type             string        `yaml:"type,omitempty" json:"type,omitempty"`
+	Protocol         string        `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	Send             string        `yaml:"send,omitempty" json:"send,omitempty"`
+	SendHex          string        `yaml:"send_hex,omitempty" json:"send_hex,omitempty"`
+	Expect           string        `yaml:"expect,omitempty" json:"expect,omitempty"`
+	BestEffort       bool          `yaml:"best_effort,omitempty" json:"best_effort,omitempty"`
+	HTTP             *HTTPCheck    `yaml:"http,omitempty" json:"http,omitempty"`
+	TLS              *TLSCheck     `yaml:"tls,omitempty" json:"tls,omitempty"`
+	DNS              *DNSCheck     `yaml:"dns,omitempty" json:"dns,omitempty"`
+
+	// Source is the config file the check was loaded from.
+	Source string `yaml:"-" json:"-"`
+}
+
+// HTTPCheck configures an application-level HTTP(S) check (type: http).
+// The check's host and port default to those of URL and must match them.
+// Without ExpectedStatus any 2xx or 3xx response is accepted.
+// Redirects are only followed when FollowRedirects is set, up to MaxRedirects.
+type HTTPCheck struct {
+	URL                string            `yaml:"url" json:"url"`
+	Method             string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Headers            map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body               string            `yaml:"body,omitempty" json:"body,omitempty"`
+	ExpectedStatus     []int             `yaml:"expected_status,omitempty" json:"expected_status,omitempty"`
+	BodyContains       string            `yaml:"body_contains,omitempty" json:"body_contains,omitempty"`
+	BodyRegex          string            `yaml:"body_regex,omitempty" json:"body_regex,omitempty"`
+	FollowRedirects    bool              `yaml:"follow_redirects,omitempty" json:"follow_redirects,omitempty"`
+	MaxRedirects       int               `yaml:"max_redirects,omitempty" json:"max_redirects,omitempty"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+}
+
+// TLSCheck configures a TLS handshake and certificate check (type: tls).
+// ServerName overrides the SNI name, which defaults to the check host.
+// CAFile points to a PEM bundle used instead of the system roots; a relative
+// path is relative to the file that defines the check.
+// A leaf certificate expiring within ExpiryCriticalDays fails the check,
+// within ExpiryWarningDays it only adds a warning to the result.
+// StartTLS upgrades a plain connection first: "smtp", "imap", "pop3" or "sieve".
+type TLSCheck struct {
+	StartTLS           string `yaml:"starttls,omitempty" json:"starttls,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+	ExpiryWarningDays  int    `yaml:"expiry_warning_days,omitempty" json:"expiry_warning_days,omitempty"`
+	ExpiryCriticalDays int    `yaml:"expiry_critical_days,omitempty" json:"expiry_critical_days,omitempty"`
+}
+
+// DNSCheck configures a DNS resolution check (type: dns) against the server
+// at the check's host and port (default 53).
+// RecordType is one of A (default), AAAA, MX, SRV, TXT or CNAME and Protocol
+// is "udp" (default) or "tcp". The check requires NOERROR and every Expected
+// answer; without Expected at least MinAnswers (default 1) answers. Expected
+// TXT data must match exactly, names in other records ignore case.
+type DNSCheck struct {
+	Query      string   `yaml:"query" json:"query"`
+	RecordType string   `yaml:"record_type,omitempty" json:"record_type,omitempty"`
+	Protocol   string   `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	Expected   []string `yaml:"expected,omitempty" json:"expected,omitempty"`
+	MinAnswers int      `yaml:"min_answers,omitempty" json:"min_answers,omitempty"`
 }
 
 // HealthStatus represents the overall health check response.
-// It contains the aggregated status and results from all port checks.
+// It contains the aggregated status and results from all port checks,
+// and the generation and load time of the active configuration.
 type HealthStatus struct {
-	Status  string            `json:"status"`
-	Message string            `json:"message"`
-	Checks  []PortCheckResult `json:"checks"`
-	Time    string            `json:"timestamp"`
-	Version string            `json:"version"`
+	Status           string            `json:"status"`
+	Message          string            `json:"message"`
+	Checks           []PortCheckResult `json:"checks"`
+	Time             string            `json:"timestamp"`
+	Version          string            `json:"version"`
+	ConfigGeneration int               `json:"config_generation,omitempty"`
+	ConfigLoadedAt   string            `json:"config_loaded_at,omitempty"`
 }
 
 // PortCheckResult holds the result of checking a single port.
 // It includes the check details and whether the port is reachable.
+// CheckedAt records when the check was executed, which shows how fresh a cached result is.
+// LatencyMS is the duration of the check in milliseconds; HTTPStatus is set for HTTP checks.
+// ConnectMS is the TCP connect latency and TTFBMS the time until the first
+// response byte, both measured from the start of the (last) attempt.
+// Warning reports a non-fatal problem such as a certificate that expires soon.
+// Banner holds the (truncated) response matched by an expect pattern.
+// BestEffort marks UDP checks that only sent a datagram without awaiting a reply.
+// Source is the config file that defines the check.
+// Severity is the configured impact of a failure on the overall status;
+// Groups and Tags are copied from the check as well.
+// ConsecutiveFailures and ConsecutiveSuccesses count the latest run of equal
+// outcomes; LastStateChange is when Status last flipped.
+// Attempts and AttemptErrors are set for checks configured with retries.
 type PortCheckResult struct {
-	Name        string `json:"name"`
-	Host        string `json:"host"`
-	Port        int    `json:"port"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
-	Error       string `json:"error,omitempty"`
+	Name                 string           `json:"name"`
+	Host                 string           `json:"host"`
+	Port                 int              `json:"port"`
+	Description          string           `json:"description"`
+	Source               string           `json:"source,omitempty"`
+	Severity             string           `json:"severity,omitempty"`
+	Groups               []string         `json:"groups,omitempty"`
+	Tags                 []string         `json:"tags,omitempty"`
+	Status               string           `json:"status"`
+	Error                string           `json:"error,omitempty"`
+	Warning              string           `json:"warning,omitempty"`
+	Banner               string           `json:"banner,omitempty"`
+	BestEffort           bool             `json:"best_effort,omitempty"`
+	CheckedAt            string           `json:"checked_at,omitempty"`
+	ConsecutiveFailures  int              `json:"consecutive_failures,omitempty"`
+	ConsecutiveSuccesses int              `json:"consecutive_successes,omitempty"`
+	LastStateChange      string           `json:"last_state_change,omitempty"`
+	Attempts             int              `json:"attempts,omitempty"`
+	AttemptErrors        []string         `json:"attempt_errors,omitempty"`
+	LatencyMS            float64          `json:"latency_ms,omitempty"`
+	ConnectMS            float64          `json:"connect_ms,omitempty"`
+	TTFBMS               float64          `json:"ttfb_ms,omitempty"`
+	HTTPStatus           int              `json:"http_status,omitempty"`
+	Certificate          *CertificateInfo `json:"certificate,omitempty"`
+	DNS                  *DNSResult       `json:"dns,omitempty"`
+}
+
+// ChatNotifier posts a formatted message to a chat incoming webhook at URL
+// (type: slack, mattermost or teams). Channel and Username override the
+// defaults of a Slack or Mattermost webhook; Teams does not support them.
+type ChatNotifier struct {
+	URL      string `yaml:"url"`
+	Channel  string `yaml:"channel,omitempty"`
+	Username string `yaml:"username,omitempty"`
+}
+
+// SMTPNotifier sends state changes by email (type: smtp).
+// TLS is "starttls" (default), "implicit" for SMTPS or "none"; Port defaults
+// to 587, 465 or 25 accordingly. Username and Password enable PLAIN
+// authentication, which is refused on unencrypted connections except to
+// localhost; PasswordFile reads the password from a file instead. CAFile
+// replaces the system roots for verifying the server; a relative path is
+// relative to the config file. From and To are addresses such as ops@example.com or "Ops <ops@example.com>";
+// the display name only appears in the message headers. Subject is a Go
+// text/template executed with the latest StateChange and .Changes, the list
+// of all changes in the email.
+type SMTPNotifier struct {
+	Host               string   `yaml:"host"`
+	Port               int      `yaml:"port,omitempty"`
+	TLS                string   `yaml:"tls,omitempty"`
+	CAFile             string   `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify,omitempty"`
+	Username           string   `yaml:"username,omitempty"`
+	Password           string   `yaml:"password,omitempty"`
+	PasswordFile       string   `yaml:"password_file,omitempty"`
+	From               string   `yaml:"from"`
+	To                 []string `yaml:"to"`
+	Subject            string   `yaml:"subject,omitempty"`
+}
+
+// EventsNotifier opens and resolves incidents through an Events API v2
+// endpoint (type: pagerduty), such as PagerDuty or a compatible Opsgenie
+// integration. URL defaults to the PagerDuty endpoint; RoutingKey is the
+// integration key of the service, or read from RoutingKeyFile.
+type EventsNotifier struct {
+	URL            string `yaml:"url,omitempty"`
+	RoutingKey     string `yaml:"routing_key,omitempty"`
+	RoutingKeyFile string `yaml:"routing_key_file,omitempty"`
+}
+
+// AlertmanagerNotifier pushes alerts for failing checks to the Alertmanager
+// v2 API at URL, e.g. http://alertmanager:9093 (type: alertmanager).
+// Firing alerts are re-sent every ResendInterval (default 1m) and expire
+// after four intervals without one; a recovered check ends its alert.
+// Labels are added to the labels derived from the check.
+type AlertmanagerNotifier struct {
+	URL            string            `yaml:"url"`
+	ResendInterval time.Duration     `yaml:"resend_interval,omitempty"`
+	Labels         map[string]string `yaml:"labels,omitempty"`
+}
+
+// ExecNotifier runs Command, the program and its arguments, for every state
+// change (type: exec). The change is passed as PORTGUARD_* environment
+// variables and as JSON on stdin; Env adds variables of its own. The
+// notifier's timeout kills a command that runs too long, and a non-zero exit
+// status counts as a failed attempt. A relative path in Command is relative to
+// the config file. MaxConcurrent (default 1) limits the commands running at
+// once; changes of the same check never run in parallel.
+type ExecNotifier struct {
+	Command       []string          `yaml:"command"`
+	Env           map[string]string `yaml:"env,omitempty"`
+	MaxConcurrent int               `yaml:"max_concurrent,omitempty"`
+}
+
+// StateChange is the notification sent when the status of a check changes.
+// OldStatus is "unknown" for the first result of a check that is not healthy,
+// and NewStatus is "removed" when a reload drops a check that was failing.
+// Timestamp is when the new status was recorded, in RFC 3339 format.
+// FailingChecks names every check that is not healthy after the change, and
+// URL links to the check when notifications.base_url is set.
+type StateChange struct {
+	Name          string   `json:"name"`
+	Host          string   `json:"host"`
+	Port          int      `json:"port"`
+	Address       string   `json:"address"`
+	Description   string   `json:"description,omitempty"`
+	Severity      string   `json:"severity,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	OldStatus     string   `json:"old_status"`
+	NewStatus     string   `json:"new_status"`
+	Error         string   `json:"error,omitempty"`
+	Warning       string   `json:"warning,omitempty"`
+	Timestamp     string   `json:"timestamp"`
+	FailingChecks []string `json:"failing_checks,omitempty"`
+	URL           string   `json:"url,omitempty"`
+}
+
+// DeadLetter records a notification that could not be delivered.
+type DeadLetter struct {
+	Time     string      `json:"time"`
+	Notifier string      `json:"notifier"`
+	Error    string      `json:"error"`
+	Change   StateChange `json:"change"`
+}
+
+// CertificateInfo describes the leaf certificate presented by a TLS endpoint.
+type CertificateInfo struct {
+	Subject       string   `json:"subject"`
+	Issuer        string   `json:"issuer"`
+	SANs          []string `json:"sans,omitempty"`
+	NotAfter      string   `json:"not_after"`
+	DaysRemaining int      `json:"days_remaining"`
+}
+
+// DNSResult holds the response code and answers of a DNS check.
+type DNSResult struct {
+	Rcode   string   `json:"rcode"`
+	Answers []string `json:"answers"`
 }
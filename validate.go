@@ -0,0 +1,514 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configError is a single validation problem, located by its YAML line
+// (0 if unknown). File is only set for problems in included files.
+type configError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e configError) String() string {
+	message := e.Message
+	if e.Line > 0 {
+		message = fmt.Sprintf("line %d: %s", e.Line, message)
+	}
+	if e.File != "" {
+		message = e.File + ": " + message
+	}
+	return message
+}
+
+// configErrors collects every validation problem found in a config file.
+type configErrors []configError
+
+func (e configErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.String()
+	}
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(messages, "\n  "))
+}
+
+// configPositions maps config fields to the YAML lines they were defined on.
+type configPositions struct {
+	server        map[string]int
+	checks        []checkPosition
+	notifications map[string]int
+	notifiers     []checkPosition
+}
+
+type checkPosition struct {
+	file   string
+	line   int
+	fields map[string]int
+}
+
+// newConfigPositions records the lines of the server, check and notifier
+// fields in the YAML document root. file is empty for the main config file.
+func newConfigPositions(root *yaml.Node, file string) configPositions {
+	var positions configPositions
+	if root == nil || root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return positions
+	}
+
+	if server := mappingValue(root.Content[0], "server"); server != nil {
+		positions.server = mappingLines(server)
+	}
+	if checks := mappingValue(root.Content[0], "checks"); checks != nil && checks.Kind == yaml.SequenceNode {
+		for _, item := range checks.Content {
+			positions.checks = append(positions.checks, checkPosition{file: file, line: item.Line, fields: mappingLines(item)})
+		}
+	}
+	if notifications := mappingValue(root.Content[0], "notifications"); notifications != nil {
+		positions.notifications = mappingLines(notifications)
+		if notifiers := mappingValue(notifications, "notifiers"); notifiers != nil && notifiers.Kind == yaml.SequenceNode {
+			for _, item := range notifiers.Content {
+				positions.notifiers = append(positions.notifiers, checkPosition{file: file, line: item.Line, fields: mappingLines(item)})
+			}
+		}
+	}
+	return positions
+}
+
+// serverLine returns the line of server.field, if known.
+func (p configPositions) serverLine(field string) int {
+	return p.server[field]
+}
+
+// checkLocation returns the file and line of field in check i, falling back
+// to the line where the check starts.
+func (p configPositions) checkLocation(i int, field string) (string, int) {
+	if i >= len(p.checks) {
+		return "", 0
+	}
+	if line, ok := p.checks[i].fields[field]; ok {
+		return p.checks[i].file, line
+	}
+	return p.checks[i].file, p.checks[i].line
+}
+
+// notifierLine returns the line of field in notifier i, falling back to the
+// line where the notifier starts.
+func (p configPositions) notifierLine(i int, field string) int {
+	if i >= len(p.notifiers) {
+		return 0
+	}
+	if line, ok := p.notifiers[i].fields[field]; ok {
+		return line
+	}
+	return p.notifiers[i].line
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mappingLines(node *yaml.Node) map[string]int {
+	lines := make(map[string]int)
+	if node.Kind != yaml.MappingNode {
+		return lines
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		lines[node.Content[i].Value] = node.Content[i].Line
+	}
+	return lines
+}
+
+// validateConfig checks cfg for values that would make checks meaningless or
+// fail at runtime and returns all problems at once, or nil.
+func validateConfig(cfg *Config, positions configPositions) error {
+	var errs configErrors
+	serverErr := func(field, format string, args ...interface{}) {
+		errs = append(errs, configError{Line: positions.serverLine(field), Message: "server." + field + ": " + fmt.Sprintf(format, args...)})
+	}
+
+	if port, err := strconv.Atoi(cfg.Server.Port); err != nil || port < 1 || port > 65535 {
+		serverErr("port", "%q is not a valid port (1-65535)", cfg.Server.Port)
+	}
+	if cfg.Server.Timeout < 0 {
+		serverErr("timeout", "must not be negative")
+	}
+	if cfg.Server.Deadline < 0 {
+		serverErr("deadline", "must not be negative")
+	}
+	if cfg.Server.MaxConcurrency < 0 {
+		serverErr("max_concurrency", "must not be negative")
+	}
+	if cfg.Server.CheckInterval < 0 {
+		serverErr("check_interval", "must not be negative")
+	}
+	if code := cfg.Server.DegradedStatusCode; code != 0 && (code < 200 || code > 599) {
+		serverErr("degraded_status_code", "%d is not a valid HTTP status code", code)
+	}
+
+	names := make(map[string]int)
+	for i, portCheck := range cfg.Checks {
+		checkErr := func(field, format string, args ...interface{}) {
+			label := fmt.Sprintf("checks[%d]", i)
+			if portCheck.Name != "" {
+				label = fmt.Sprintf("check %q", portCheck.Name)
+			}
+			file, line := positions.checkLocation(i, field)
+			errs = append(errs, configError{
+				File:    file,
+				Line:    line,
+				Message: fmt.Sprintf("%s: %s: %s", label, field, fmt.Sprintf(format, args...)),
+			})
+		}
+
+		if portCheck.Name == "" {
+			checkErr("name", "must not be empty")
+		} else if first, ok := names[portCheck.Name]; ok {
+			_, line := positions.checkLocation(first, "name")
+			if source := cfg.Checks[first].Source; source != portCheck.Source {
+				checkErr("name", "duplicate name, first defined in %s at line %d", source, line)
+			} else {
+				checkErr("name", "duplicate name, first defined at line %d", line)
+			}
+		} else {
+			names[portCheck.Name] = i
+		}
+
+		// HTTP checks take their host from the URL, which is validated below.
+		if portCheck.Host == "" && (portCheck.Type != checkTypeHTTP || portCheck.HTTP == nil) {
+			checkErr("host", "must not be empty")
+		}
+		if portCheck.Port < 1 || portCheck.Port > 65535 {
+			checkErr("port", "%d is out of range (1-65535)", portCheck.Port)
+		}
+		switch portCheck.Severity {
+		case "", severityCritical, severityWarning, severityInfo:
+		default:
+			checkErr("severity", "unknown severity %q (want critical, warning or info)", portCheck.Severity)
+		}
+		if slices.Contains(portCheck.Groups, "") {
+			checkErr("groups", "group names must not be empty")
+		}
+		if slices.Contains(portCheck.Tags, "") {
+			checkErr("tags", "tags must not be empty")
+		}
+		if portCheck.FailureThreshold < 0 {
+			checkErr("failure_threshold", "must not be negative")
+		}
+		if portCheck.SuccessThreshold < 0 {
+			checkErr("success_threshold", "must not be negative")
+		}
+		if portCheck.Attempts < 0 {
+			checkErr("attempts", "must not be negative")
+		}
+		if portCheck.RetryBackoff < 0 {
+			checkErr("retry_backoff", "must not be negative")
+		}
+		if portCheck.WarnLatency < 0 {
+			checkErr("warn_latency", "must not be negative")
+		}
+		if portCheck.MaxLatency < 0 {
+			checkErr("max_latency", "must not be negative")
+		} else if portCheck.MaxLatency > 0 && portCheck.WarnLatency >= portCheck.MaxLatency {
+			checkErr("warn_latency", "must be below max_latency")
+		}
+		if portCheck.Timeout < 0 {
+			checkErr("timeout", "must not be negative")
+		}
+		if portCheck.Interval < 0 {
+			checkErr("interval", "must not be negative")
+		}
+
+		for _, problem := range validateCheckType(portCheck) {
+			checkErr(problem.field, "%s", problem.message)
+		}
+	}
+
+	if baseURL := cfg.Notifications.BaseURL; baseURL != "" && !isHTTPURL(baseURL) {
+		errs = append(errs, configError{
+			Line:    positions.notifications["base_url"],
+			Message: fmt.Sprintf("notifications.base_url: %q must be an absolute http:// or https:// URL", baseURL),
+		})
+	}
+
+	notifierNames := make(map[string]bool)
+	for i, notifierCfg := range cfg.Notifications.Notifiers {
+		notifierErr := func(field, format string, args ...interface{}) {
+			label := fmt.Sprintf("notifiers[%d]", i)
+			if notifierCfg.Name != "" {
+				label = fmt.Sprintf("notifier %q", notifierCfg.Name)
+			}
+			errs = append(errs, configError{
+				Line:    positions.notifierLine(i, field),
+				Message: fmt.Sprintf("notifications: %s: %s: %s", label, field, fmt.Sprintf(format, args...)),
+			})
+		}
+
+		if notifierCfg.Name == "" {
+			notifierErr("name", "must not be empty")
+		} else if notifierNames[notifierCfg.Name] {
+			notifierErr("name", "duplicate name")
+		}
+		notifierNames[notifierCfg.Name] = true
+
+		if notifierCfg.Timeout < 0 {
+			notifierErr("timeout", "must not be negative")
+		}
+		if notifierCfg.Attempts < 0 {
+			notifierErr("attempts", "must not be negative")
+		}
+		if notifierCfg.RetryBackoff < 0 {
+			notifierErr("retry_backoff", "must not be negative")
+		}
+		if notifierCfg.BatchWindow < 0 {
+			notifierErr("batch_window", "must not be negative")
+		} else if notifierCfg.BatchWindow > 0 && notifierCfg.Type != notifierTypeSMTP {
+			notifierErr("batch_window", "only supported by smtp notifiers")
+		}
+
+		for _, problem := range validateNotifierType(notifierCfg) {
+			notifierErr(problem.field, "%s", problem.message)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type fieldProblem struct {
+	field   string
+	message string
+}
+
+// labelNamePattern matches valid Prometheus and Alertmanager label names.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateNotifierType validates the fields that depend on the notifier type.
+func validateNotifierType(notifierCfg NotifierConfig) []fieldProblem {
+	var problems []fieldProblem
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, fieldProblem{field: field, message: fmt.Sprintf(format, args...)})
+	}
+
+	switch notifierCfg.Type {
+	case notifierTypeWebhook:
+		if notifierCfg.Webhook == nil {
+			add("webhook", "required for type: webhook")
+			break
+		}
+		if !isHTTPURL(notifierCfg.Webhook.URL) {
+			add("webhook", "url %q must be an absolute http:// or https:// URL", notifierCfg.Webhook.URL)
+		}
+		if _, err := newWebhookNotifier(notifierCfg.Webhook); err != nil {
+			add("webhook", "%v", err)
+		}
+	case notifierTypeSlack, notifierTypeMattermost, notifierTypeTeams:
+		chat := map[string]*ChatNotifier{
+			notifierTypeSlack:      notifierCfg.Slack,
+			notifierTypeMattermost: notifierCfg.Mattermost,
+			notifierTypeTeams:      notifierCfg.Teams,
+		}[notifierCfg.Type]
+		if chat == nil {
+			add(notifierCfg.Type, "required for type: %s", notifierCfg.Type)
+			break
+		}
+		if !isHTTPURL(chat.URL) {
+			add(notifierCfg.Type, "url %q must be an absolute http:// or https:// URL", chat.URL)
+		}
+		if notifierCfg.Type == notifierTypeTeams && (chat.Channel != "" || chat.Username != "") {
+			add(notifierCfg.Type, "channel and username are not supported by teams")
+		}
+	case notifierTypeSMTP:
+		smtpCfg := notifierCfg.SMTP
+		if smtpCfg == nil {
+			add("smtp", "required for type: smtp")
+			break
+		}
+		if smtpCfg.Host == "" {
+			add("smtp", "host is required")
+		}
+		if smtpCfg.Port < 0 || smtpCfg.Port > 65535 {
+			add("smtp", "port %d is out of range (1-65535)", smtpCfg.Port)
+		}
+		switch smtpCfg.TLS {
+		case "", smtpTLSStartTLS, smtpTLSImplicit, smtpTLSNone:
+		default:
+			add("smtp", "unknown tls mode %q (want starttls, implicit or none)", smtpCfg.TLS)
+		}
+		if smtpCfg.From == "" {
+			add("smtp", "from is required")
+		} else if _, err := mail.ParseAddress(smtpCfg.From); err != nil {
+			add("smtp", "invalid from address %q: %v", smtpCfg.From, err)
+		}
+		if len(smtpCfg.To) == 0 {
+			add("smtp", "to must list at least one recipient")
+		}
+		for _, to := range smtpCfg.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				add("smtp", "invalid to address %q: %v", to, err)
+			}
+		}
+		if _, err := parseSMTPSubject(smtpCfg.Subject); err != nil {
+			add("smtp", "%v", err)
+		}
+	case notifierTypePagerDuty:
+		if notifierCfg.PagerDuty == nil {
+			add("pagerduty", "required for type: pagerduty")
+			break
+		}
+		if notifierCfg.PagerDuty.RoutingKey == "" {
+			add("pagerduty", "routing_key or routing_key_file is required")
+		}
+		if u := notifierCfg.PagerDuty.URL; u != "" && !isHTTPURL(u) {
+			add("pagerduty", "url %q must be an absolute http:// or https:// URL", u)
+		}
+	case notifierTypeAlertmanager:
+		alertmanager := notifierCfg.Alertmanager
+		if alertmanager == nil {
+			add("alertmanager", "required for type: alertmanager")
+			break
+		}
+		if !isHTTPURL(alertmanager.URL) {
+			add("alertmanager", "url %q must be an absolute http:// or https:// URL", alertmanager.URL)
+		}
+		if alertmanager.ResendInterval < 0 {
+			add("alertmanager", "resend_interval must not be negative")
+		}
+		for name := range alertmanager.Labels {
+			if !labelNamePattern.MatchString(name) {
+				add("alertmanager", "invalid label name %q", name)
+			}
+		}
+	case notifierTypeExec:
+		if notifierCfg.Exec == nil {
+			add("exec", "required for type: exec")
+			break
+		}
+		if _, err := newExecNotifier(notifierCfg.Name, notifierCfg.Exec); err != nil {
+			add("exec", "%v", err)
+		}
+		if notifierCfg.Exec.MaxConcurrent < 0 {
+			add("exec", "max_concurrent must not be negative")
+		}
+	default:
+		add("type", "unknown notifier type %q (want webhook, slack, mattermost, teams, smtp, pagerduty, alertmanager or exec)", notifierCfg.Type)
+	}
+	return problems
+}
+
+// isHTTPURL reports whether raw is an absolute http:// or https:// URL.
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateCheckType validates the fields that depend on the check type.
+func validateCheckType(portCheck PortCheck) []fieldProblem {
+	var problems []fieldProblem
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, fieldProblem{field: field, message: fmt.Sprintf(format, args...)})
+	}
+
+	if portCheck.Expect != "" {
+		if _, err := regexp.Compile(portCheck.Expect); err != nil {
+			add("expect", "invalid regular expression: %v", err)
+		}
+	}
+
+	switch portCheck.Type {
+	case "", checkTypeTCP:
+		switch portCheck.Protocol {
+		case "", protocolTCP:
+			if portCheck.SendHex != "" || portCheck.BestEffort {
+				add("protocol", "send_hex and best_effort require protocol: udp")
+			}
+		case protocolUDP:
+			if portCheck.SendHex != "" {
+				if _, err := udpPayload(portCheck); err != nil {
+					add("send_hex", "%v", err)
+				}
+			}
+		default:
+			add("protocol", "unknown protocol %q (want tcp or udp)", portCheck.Protocol)
+		}
+	case checkTypeHTTP:
+		if portCheck.HTTP == nil {
+			add("http", "required for type: http")
+			break
+		}
+		if !isHTTPURL(portCheck.HTTP.URL) {
+			add("http", "url %q must be an absolute http:// or https:// URL", portCheck.HTTP.URL)
+		} else if host, port, err := httpURLTarget(portCheck.HTTP.URL); err == nil {
+			// Requests go to the URL, so host and port must not name a
+			// different target; they are derived from the URL when omitted.
+			if !strings.EqualFold(portCheck.Host, host) {
+				add("http", "host %q does not match the url host %q", portCheck.Host, host)
+			}
+			if portCheck.Port != port {
+				add("http", "port %d does not match the url port %d", portCheck.Port, port)
+			}
+		}
+		for _, code := range portCheck.HTTP.ExpectedStatus {
+			if code < 100 || code > 599 {
+				add("http", "expected_status %d is not a valid HTTP status code", code)
+			}
+		}
+		if portCheck.HTTP.BodyRegex != "" {
+			if _, err := regexp.Compile(portCheck.HTTP.BodyRegex); err != nil {
+				add("http", "invalid body_regex: %v", err)
+			}
+		}
+	case checkTypeTLS:
+		if portCheck.TLS == nil {
+			break
+		}
+		switch portCheck.TLS.StartTLS {
+		case "", startTLSSMTP, startTLSIMAP, startTLSPOP3, startTLSSieve:
+		default:
+			add("tls", "unknown starttls protocol %q (want smtp, imap, pop3 or sieve)", portCheck.TLS.StartTLS)
+		}
+		if portCheck.TLS.ExpiryWarningDays < 0 || portCheck.TLS.ExpiryCriticalDays < 0 {
+			add("tls", "expiry days must not be negative")
+		}
+	case checkTypeDNS:
+		if portCheck.DNS == nil || portCheck.DNS.Query == "" {
+			add("dns", "query is required for type: dns")
+			break
+		}
+		if _, ok := dnsRecordTypes[strings.ToUpper(portCheck.DNS.RecordType)]; !ok && portCheck.DNS.RecordType != "" {
+			add("dns", "unsupported record_type %q", portCheck.DNS.RecordType)
+		}
+		if p := portCheck.DNS.Protocol; p != "" && p != protocolUDP && p != protocolTCP {
+			add("dns", "unknown protocol %q (want udp or tcp)", p)
+		}
+		if portCheck.DNS.MinAnswers < 0 {
+			add("dns", "min_answers must not be negative")
+		}
+	default:
+		add("type", "unknown check type %q (want tcp, http, tls or dns)", portCheck.Type)
+	}
+
+	if portCheck.Type != "" && portCheck.Type != checkTypeTCP && portCheck.Protocol != "" {
+		add("protocol", "only supported for tcp checks")
+	}
+
+	return problems
+}
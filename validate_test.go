@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		configData string
+		wantErrs   []string
+	}{
+		{
+			name: "valid config",
+			configData: `
+server:
+  port: "8888"
+checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+  - type: http
+    name: "Web"
+    http:
+      url: "https://example.com/health"
+      expected_status: [200, 204]
+`,
+		},
+		{
+			name: "port out of range",
+			configData: `
+checks:
+  - host: "localhost"
+    port: 70000
+    name: "Bad port"
+  - host: "localhost"
+    name: "No port"
+`,
+			wantErrs: []string{
+				`line 4: check "Bad port": port: 70000 is out of range (1-65535)`,
+				`line 6: check "No port": port: 0 is out of range (1-65535)`,
+			},
+		},
+		{
+			name: "server fields",
+			configData: `
+server:
+  port: "99999"
+  timeout: -1s
+  max_concurrency: -2
+checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+`,
+			wantErrs: []string{
+				`line 3: server.port: "99999" is not a valid port (1-65535)`,
+				`line 4: server.timeout: must not be negative`,
+				`line 5: server.max_concurrency: must not be negative`,
+			},
+		},
+		{
+			name: "empty host and name, negative timeout",
+			configData: `
+checks:
+  - host: ""
+    port: 22
+    timeout: -5s
+`,
+			wantErrs: []string{
+				`line 3: checks[0]: name: must not be empty`,
+				`line 3: checks[0]: host: must not be empty`,
+				`line 5: checks[0]: timeout: must not be negative`,
+			},
+		},
+		{
+			name: "duplicate names",
+			configData: `
+checks:
+  - host: "a.example.com"
+    port: 22
+    name: "SSH"
+  - host: "b.example.com"
+    port: 22
+    name: "SSH"
+`,
+			wantErrs: []string{
+				`line 8: check "SSH": name: duplicate name, first defined at line 5`,
+			},
+		},
+		{
+			name: "type specific fields",
+			configData: `
+checks:
+  - host: "localhost"
+    port: 25
+    name: "Unknown"
+    type: smtp
+  - name: "Web"
+    type: http
+    http:
+      url: "example.com"
+      body_regex: "("
+  - host: "localhost"
+    port: 53
+    name: "Resolver"
+    type: dns
+  - host: "localhost"
+    port: 9000
+    name: "Game"
+    protocol: udp
+    send_hex: "zz"
+  - host: "localhost"
+    port: 587
+    name: "Submission"
+    type: tls
+    tls:
+      starttls: ftp
+  - host: "localhost"
+    port: 4190
+    name: "Sieve"
+    severity: optional
+  - host: "10.0.0.2"
+    port: 8443
+    name: "Webmail"
+    type: http
+    http:
+      url: "https://mail.example.com/"
+`,
+			wantErrs: []string{
+				`line 6: check "Unknown": type: unknown check type "smtp"`,
+				`line 9: check "Web": http: url "example.com" must be an absolute http:// or https:// URL`,
+				`line 9: check "Web": http: invalid body_regex`,
+				`line 12: check "Resolver": dns: query is required for type: dns`,
+				`line 20: check "Game": send_hex:`,
+				`line 25: check "Submission": tls: unknown starttls protocol "ftp"`,
+				`line 30: check "Sieve": severity: unknown severity "optional"`,
+				`line 35: check "Webmail": http: host "10.0.0.2" does not match the url host "mail.example.com"`,
+				`line 35: check "Webmail": http: port 8443 does not match the url port 443`,
+			},
+		},
+		{
+			name: "notifiers",
+			configData: `
+checks:
+  - host: "localhost"
+    port: 22
+    name: "SSH"
+notifications:
+  notifiers:
+    - name: "ops"
+      type: webhook
+      webhook:
+        url: "https://hooks.example.com/portguard"
+        template: '{"text": {{json .Name}}}'
+    - name: "ops"
+      type: webhook
+      attempts: -1
+      webhook:
+        url: "hooks.example.com"
+        template: "{{.Name"
+    - type: pager
+    - name: "chat"
+      type: teams
+      teams:
+        url: "https://example.webhook.office.com/x"
+        channel: "#ops"
+    - name: "slack"
+      type: slack
+    - name: "mail"
+      type: smtp
+      batch_window: 30s
+      smtp:
+        host: "mail.example.com"
+        tls: ssl
+        from: "PortGuard <portguard>"
+        to: []
+        subject: "{{.Nope"
+    - name: "hook"
+      type: webhook
+      batch_window: 30s
+      webhook:
+        url: "https://hooks.example.com/portguard"
+    - name: "pager"
+      type: pagerduty
+      pagerduty:
+        url: "localhost:8080"
+    - name: "am"
+      type: alertmanager
+      alertmanager:
+        url: "http://alertmanager:9093"
+        labels:
+          team-name: "mail"
+    - name: "restart"
+      type: exec
+      exec:
+        command: []
+        max_concurrent: -1
+  base_url: "portguard.example.com"
+`,
+			wantErrs: []string{
+				`line 56: notifications.base_url: "portguard.example.com" must be an absolute http:// or https:// URL`,
+				`line 13: notifications: notifier "ops": name: duplicate name`,
+				`line 15: notifications: notifier "ops": attempts: must not be negative`,
+				`line 16: notifications: notifier "ops": webhook: url "hooks.example.com" must be an absolute http:// or https:// URL`,
+				`line 16: notifications: notifier "ops": webhook: invalid template`,
+				`line 19: notifications: notifiers[2]: name: must not be empty`,
+				`line 19: notifications: notifiers[2]: type: unknown notifier type "pager"`,
+				`line 22: notifications: notifier "chat": teams: channel and username are not supported by teams`,
+				`line 25: notifications: notifier "slack": slack: required for type: slack`,
+				`line 30: notifications: notifier "mail": smtp: unknown tls mode "ssl"`,
+				`line 30: notifications: notifier "mail": smtp: invalid from address "PortGuard <portguard>"`,
+				`line 30: notifications: notifier "mail": smtp: to must list at least one recipient`,
+				`line 30: notifications: notifier "mail": smtp: invalid subject template`,
+				`line 38: notifications: notifier "hook": batch_window: only supported by smtp notifiers`,
+				`line 43: notifications: notifier "pager": pagerduty: routing_key or routing_key_file is required`,
+				`line 43: notifications: notifier "pager": pagerduty: url "localhost:8080" must be an absolute http:// or https:// URL`,
+				`line 47: notifications: notifier "am": alertmanager: invalid label name "team-name"`,
+				`line 53: notifications: notifier "restart": exec: command must not be empty`,
+				`line 53: notifications: notifier "restart": exec: max_concurrent must not be negative`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.configData), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+
+			_, err := loadConfig(configPath)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var errs configErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected configErrors, got %v", err)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("Got %d errors, want %d:\n%v", len(errs), len(tt.wantErrs), err)
+			}
+			for i, want := range tt.wantErrs {
+				if got := errs[i].String(); !strings.HasPrefix(got, want) {
+					t.Errorf("Error %d = %q, want prefix %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configData := `
+server:
+  timout: 5s
+checks:
+  - host: "localhost"
+    port: 0
+    name: "SSH"
+  - host: "localhost"
+    port: 25
+    name: "SSH"
+  - host: ""
+    port: 70000
+    name: "IMAP"
+  - host: "localhost"
+    port: 110
+    name: "POP3"
+    timeout: soon
+`
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err := loadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for unknown field")
+	}
+
+	// Decoding problems do not hide the validation errors
+	for _, want := range []string{
+		"line 3: field timout not found",
+		"line 17: cannot unmarshal !!str `soon`",
+		`line 6: check "SSH": port: 0 is out of range`,
+		`line 10: check "SSH": name: duplicate name`,
+		`line 11: check "IMAP": host: must not be empty`,
+		`line 12: check "IMAP": port: 70000 is out of range`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error = %v, want it to contain %q", err, want)
+		}
+	}
+}